@@ -0,0 +1,378 @@
+/*
+package diskimage builds raw partitioned disk images, such as SD card and eMMC images,
+without requiring root privileges or loop devices.
+*/
+package diskimage
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/soypat/tinyboot/boot/gpt"
+	"github.com/soypat/tinyboot/boot/mbr"
+)
+
+// DefaultAlignment is the partition alignment in bytes used when none is specified, same as modern partitioning tools.
+const DefaultAlignment = 1 << 20
+
+// Scheme is the partitioning scheme of the disk image.
+type Scheme uint8
+
+const (
+	// SchemeMBR writes a Master Boot Record partition table. More than four partitions
+	// are written as logical partitions inside an extended partition.
+	SchemeMBR Scheme = iota
+	// SchemeGPT writes a GUID Partition Table with a protective MBR.
+	SchemeGPT
+	// SchemeHybrid writes a GUID Partition Table with a hybrid MBR which maps up to three
+	// partitions marked with [Partition].Hybrid alongside the GPT protective entry.
+	SchemeHybrid
+)
+
+func (s Scheme) String() string {
+	switch s {
+	case SchemeMBR:
+		return "MBR"
+	case SchemeGPT:
+		return "GPT"
+	case SchemeHybrid:
+		return "hybrid"
+	}
+	return fmt.Sprintf("Scheme(%d)", uint8(s))
+}
+
+// Partition describes a partition to be laid out in the image.
+type Partition struct {
+	// Name is the GPT partition name. Ignored for MBR.
+	Name string
+	// Size is the size of the partition in bytes, rounded up to a whole sector. A zero size
+	// on the last partition grows it to fill the rest of the disk when [Image].Size is set.
+	Size int64
+	// MBRType is the partition type written to the MBR. Required for MBR and hybrid partitions.
+	MBRType mbr.PartitionType
+	// GPTType is the partition type GUID. Required for GPT and hybrid schemes.
+	GPTType gpt.GUID
+	// GUID is the unique partition GUID. If zero a random one is generated.
+	GUID gpt.GUID
+	// Attributes are the GPT partition attributes.
+	Attributes gpt.PartitionAttributes
+	// Bootable sets the MBR active flag. Only one partition may be bootable.
+	Bootable bool
+	// Hybrid marks the partition to be mapped in the hybrid MBR. At most 3 partitions may be marked.
+	Hybrid bool
+	// Content is read to fill the partition. If shorter than the partition the rest is zero filled.
+	// It is an error for the content to be larger than the partition.
+	Content io.Reader
+}
+
+// Image describes a disk image to be built. Call [Image.WriteTo] to stream the image out.
+type Image struct {
+	Scheme Scheme
+	// SectorSize is the logical block size in bytes. If zero 512 is used.
+	SectorSize int
+	// Alignment is the partition start alignment in bytes. If zero [DefaultAlignment] is used.
+	Alignment int64
+	// Size is the size of the disk image in bytes. If zero the smallest aligned size that fits all partitions is used.
+	Size int64
+	// DiskGUID is the GPT disk GUID. If zero a random one is generated.
+	DiskGUID gpt.GUID
+	// DiskID is the MBR unique disk identifier. Used by [SchemeMBR] and [SchemeHybrid].
+	DiskID uint32
+	// Partitions are laid out in order.
+	Partitions []Partition
+	// Rand is the source of randomness for generated GUIDs. If nil [crypto/rand.Reader] is used.
+	Rand io.Reader
+}
+
+// Layout is the result of laying out an [Image]'s partitions on disk.
+type Layout struct {
+	SectorSize int
+	NumSectors int64
+	// Partitions contains the location of each partition in the same order as [Image].Partitions.
+	Partitions []Extent
+}
+
+// Extent is a contiguous range of sectors.
+type Extent struct {
+	StartLBA int64
+	NumLBA   int64
+}
+
+// EndLBA returns the LBA after the last sector of the extent.
+func (e Extent) EndLBA() int64 { return e.StartLBA + e.NumLBA }
+
+// Layout computes the location of each partition and the size of the disk.
+func (img *Image) Layout() (Layout, error) {
+	if len(img.Partitions) == 0 {
+		return Layout{}, errors.New("no partitions")
+	}
+	l := Layout{SectorSize: img.sectorSize()}
+	ssz := int64(l.SectorSize)
+	if l.SectorSize < 512 || l.SectorSize&(l.SectorSize-1) != 0 {
+		return l, errors.New("sector size must be a power of two and at least 512")
+	}
+	align := img.Alignment
+	if align == 0 {
+		align = DefaultAlignment
+	}
+	if align < 0 || align%ssz != 0 {
+		return l, fmt.Errorf("alignment %d not a multiple of sector size %d", align, ssz)
+	}
+	alignLBA := align / ssz
+	firstUsable, tailSectors := int64(1), int64(0)
+	if img.Scheme != SchemeMBR {
+		// Use a throwaway config to compute GPT overhead, which does not depend on the disk size.
+		cfg := gpt.DiskConfig{SectorSize: l.SectorSize, NumSectors: math.MaxInt32}
+		var last int64
+		firstUsable, last = cfg.UsableLBAs()
+		tailSectors = cfg.NumSectors - 1 - last
+	}
+	numLogical := 0
+	if img.Scheme == SchemeMBR && len(img.Partitions) > 4 {
+		numLogical = len(img.Partitions) - 3
+	}
+	next := firstUsable
+	l.Partitions = make([]Extent, len(img.Partitions))
+	for i, p := range img.Partitions {
+		start := alignUp(next, alignLBA)
+		if numLogical > 0 && i >= 3 && start-1 < next {
+			start = alignUp(next+1, alignLBA) // Room for EBR.
+		}
+		if p.Size < 0 {
+			return l, fmt.Errorf("partition %d: negative size", i)
+		} else if p.Size == 0 && (i != len(img.Partitions)-1 || img.Size == 0) {
+			return l, fmt.Errorf("partition %d: zero size only allowed for last partition with fixed image size", i)
+		}
+		l.Partitions[i] = Extent{StartLBA: start, NumLBA: (p.Size + ssz - 1) / ssz}
+		next = l.Partitions[i].EndLBA()
+	}
+	minSectors := next + tailSectors
+	if img.Size == 0 {
+		l.NumSectors = alignUp(minSectors, alignLBA)
+	} else if img.Size%ssz != 0 {
+		return l, fmt.Errorf("image size %d not a multiple of sector size %d", img.Size, ssz)
+	} else {
+		l.NumSectors = img.Size / ssz
+		last := &l.Partitions[len(l.Partitions)-1]
+		if last.NumLBA == 0 {
+			last.NumLBA = l.NumSectors - tailSectors - last.StartLBA
+			minSectors = last.EndLBA() + tailSectors
+		}
+		if last.NumLBA <= 0 || minSectors > l.NumSectors {
+			return l, fmt.Errorf("partitions need %d sectors, image has %d", minSectors, l.NumSectors)
+		}
+	}
+	if img.Scheme == SchemeMBR && l.NumSectors > math.MaxUint32 {
+		return l, errors.New("MBR disk size overflows 32 bit LBA")
+	}
+	return l, nil
+}
+
+// WriteTo lays out the partitions and streams the raw disk image to w. It implements [io.WriterTo].
+func (img *Image) WriteTo(w io.Writer) (int64, error) {
+	l, err := img.Layout()
+	if err != nil {
+		return 0, err
+	}
+	var meta extentWriter
+	switch img.Scheme {
+	case SchemeMBR:
+		err = img.writeMBR(&meta, l)
+	case SchemeGPT, SchemeHybrid:
+		err = img.writeGPT(&meta, l)
+	default:
+		err = fmt.Errorf("unknown partition scheme %s", img.Scheme)
+	}
+	if err != nil {
+		return 0, err
+	}
+	chunks := meta.extents
+	for i := range img.Partitions {
+		if img.Partitions[i].Content == nil {
+			continue
+		}
+		e := l.Partitions[i]
+		chunks = append(chunks, extent{
+			off:  e.StartLBA * int64(l.SectorSize),
+			size: e.NumLBA * int64(l.SectorSize),
+			r:    img.Partitions[i].Content,
+			name: fmt.Sprintf("partition %d", i),
+		})
+	}
+	return streamExtents(w, chunks, l.NumSectors*int64(l.SectorSize))
+}
+
+func (img *Image) writeMBR(w io.WriterAt, l Layout) error {
+	parts := make([]mbr.PartitionTableEntry, len(img.Partitions))
+	bootable := 0
+	for i, p := range img.Partitions {
+		if p.MBRType == mbr.PartitionTypeUnused {
+			return fmt.Errorf("partition %d: missing MBR partition type", i)
+		}
+		attrs, err := mbrAttrs(p, &bootable)
+		if err != nil {
+			return err
+		}
+		e := l.Partitions[i]
+		parts[i] = mbr.MakePartitionTableEntryLBA(attrs, p.MBRType, uint32(e.StartLBA), uint32(e.NumLBA))
+	}
+	bs, _ := mbr.ToBootSector(make([]byte, 512))
+	bs.SetUniqueDiskID(img.DiskID)
+	return mbr.WritePartitions(w, l.SectorSize, bs, parts)
+}
+
+func (img *Image) writeGPT(w io.WriterAt, l Layout) (err error) {
+	cfg := gpt.DiskConfig{
+		SectorSize: l.SectorSize,
+		NumSectors: l.NumSectors,
+		DiskGUID:   img.DiskGUID,
+	}
+	if cfg.DiskGUID.IsZero() {
+		cfg.DiskGUID, err = gpt.NewRandomGUID(img.rand())
+		if err != nil {
+			return err
+		}
+	}
+	entries := make([]gpt.PartitionEntry, len(img.Partitions))
+	var hybrid []gpt.HybridPartition
+	for i, p := range img.Partitions {
+		if p.GPTType.IsZero() {
+			return fmt.Errorf("partition %d: missing GPT partition type", i)
+		}
+		guid := p.GUID
+		if guid.IsZero() {
+			guid, err = gpt.NewRandomGUID(img.rand())
+			if err != nil {
+				return err
+			}
+		}
+		e := l.Partitions[i]
+		entries[i] = gpt.MakePartitionEntry(p.GPTType, guid, e.StartLBA, e.EndLBA()-1, p.Attributes)
+		err = entries[i].SetNameUTF8([]byte(p.Name))
+		if err != nil {
+			return fmt.Errorf("partition %d name: %w", i, err)
+		}
+		if img.Scheme != SchemeHybrid || !p.Hybrid {
+			continue
+		} else if p.MBRType == mbr.PartitionTypeUnused {
+			return fmt.Errorf("partition %d: missing MBR partition type for hybrid partition", i)
+		}
+		hybrid = append(hybrid, gpt.HybridPartition{Index: i, Type: p.MBRType, Bootable: p.Bootable})
+	}
+	if img.Scheme == SchemeGPT {
+		return gpt.WriteDisk(w, cfg, entries)
+	}
+	return gpt.WriteHybridDisk(w, cfg, img.DiskID, entries, hybrid)
+}
+
+func (img *Image) sectorSize() int {
+	if img.SectorSize == 0 {
+		return 512
+	}
+	return img.SectorSize
+}
+
+func (img *Image) rand() io.Reader {
+	if img.Rand == nil {
+		return rand.Reader
+	}
+	return img.Rand
+}
+
+func mbrAttrs(p Partition, bootableCount *int) (mbr.DriveAttributes, error) {
+	if !p.Bootable {
+		return 0, nil
+	}
+	*bootableCount++
+	if *bootableCount > 1 {
+		return 0, errors.New("more than one bootable MBR partition")
+	}
+	return mbr.DriveAttrsBootable, nil
+}
+
+func alignUp(v, align int64) int64 {
+	return (v + align - 1) / align * align
+}
+
+// extent is a region of the output image filled either with data or by reading size bytes from r.
+type extent struct {
+	off  int64
+	data []byte
+	r    io.Reader
+	size int64
+	name string
+}
+
+// extentWriter is an [io.WriterAt] that records writes in memory. Used to capture partition table metadata.
+type extentWriter struct {
+	extents []extent
+}
+
+func (ew *extentWriter) WriteAt(b []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, errors.New("negative offset")
+	}
+	data := append([]byte(nil), b...)
+	ew.extents = append(ew.extents, extent{off: off, data: data, size: int64(len(data)), name: "partition table"})
+	return len(b), nil
+}
+
+// streamExtents writes the extents in order of offset to w filling gaps with zeros up to totalSize.
+func streamExtents(w io.Writer, extents []extent, totalSize int64) (int64, error) {
+	sort.SliceStable(extents, func(i, j int) bool { return extents[i].off < extents[j].off })
+	var zeros [4096]byte
+	var n int64
+	writeZeros := func(count int64) error {
+		for count > 0 {
+			chunk := int64(len(zeros))
+			if count < chunk {
+				chunk = count
+			}
+			nw, err := w.Write(zeros[:chunk])
+			n += int64(nw)
+			if err != nil {
+				return err
+			}
+			count -= chunk
+		}
+		return nil
+	}
+	for _, e := range extents {
+		if e.off < n {
+			return n, fmt.Errorf("%s at offset %d overlaps previous data", e.name, e.off)
+		} else if e.off+e.size > totalSize {
+			return n, fmt.Errorf("%s at offset %d exceeds image size", e.name, e.off)
+		}
+		err := writeZeros(e.off - n)
+		if err != nil {
+			return n, err
+		}
+		if e.r == nil {
+			nw, err := w.Write(e.data)
+			n += int64(nw)
+			if err != nil {
+				return n, err
+			}
+			continue
+		}
+		nc, err := io.Copy(w, io.LimitReader(e.r, e.size))
+		n += nc
+		if err != nil {
+			return n, fmt.Errorf("copying %s content: %w", e.name, err)
+		}
+		var extra [1]byte
+		if nr, _ := io.ReadFull(e.r, extra[:]); nr != 0 {
+			return n, fmt.Errorf("%s content larger than partition size %d", e.name, e.size)
+		}
+		err = writeZeros(e.size - nc)
+		if err != nil {
+			return n, err
+		}
+	}
+	err := writeZeros(totalSize - n)
+	return n, err
+}
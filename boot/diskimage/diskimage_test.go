@@ -0,0 +1,128 @@
+package diskimage
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/soypat/tinyboot/boot/gpt"
+	"github.com/soypat/tinyboot/boot/mbr"
+)
+
+const MiB = 1 << 20
+
+func TestImageGPT(t *testing.T) {
+	bootContent := bytes.Repeat([]byte("boot"), 1000)
+	img := Image{
+		Scheme: SchemeGPT,
+		Size:   8 * MiB,
+		Partitions: []Partition{
+			{Name: "boot", Size: 2 * MiB, GPTType: gpt.PartitionTypeEFISystem, Content: bytes.NewReader(bootContent)},
+			{Name: "rootfs", GPTType: gpt.PartitionTypeLinuxFilesystem},
+		},
+	}
+	var buf bytes.Buffer
+	n, err := img.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	} else if n != img.Size || int64(buf.Len()) != img.Size {
+		t.Fatalf("expected %d bytes written, got %d (%d)", img.Size, n, buf.Len())
+	}
+	disk := buf.Bytes()
+	d, err := gpt.ReadDisk(bytes.NewReader(disk), 512)
+	if err != nil {
+		t.Fatal(err)
+	} else if d.Primary.Err != nil || d.Backup.Err != nil {
+		t.Fatalf("expected healthy tables, got primary=%v backup=%v", d.Primary.Err, d.Backup.Err)
+	}
+	boot, rootfs := d.Primary.Entries[0], d.Primary.Entries[1]
+	if boot.FirstLBA() != MiB/512 || boot.LastLBA() != 3*MiB/512-1 {
+		t.Errorf("boot partition not aligned to 1MiB: %d..%d", boot.FirstLBA(), boot.LastLBA())
+	}
+	if rootfs.FirstLBA() != 3*MiB/512 || rootfs.LastLBA() != d.Primary.Header.LastUsableLBA() {
+		t.Errorf("rootfs partition does not fill disk: %d..%d", rootfs.FirstLBA(), rootfs.LastLBA())
+	}
+	if rootfs.UniquePartitionGUID().IsZero() || d.Primary.Header.DiskGUID().IsZero() {
+		t.Error("expected random GUIDs to be generated")
+	}
+	if !bytes.Equal(disk[MiB:MiB+len(bootContent)], bootContent) {
+		t.Error("boot partition content mismatch")
+	}
+}
+
+func TestImageMBR(t *testing.T) {
+	img := Image{Scheme: SchemeMBR, Alignment: 4096}
+	for i := 0; i < 6; i++ {
+		img.Partitions = append(img.Partitions, Partition{Size: 8192, MBRType: mbr.PartitionTypeLinux, Content: bytes.NewReader([]byte{byte(i + 1)})})
+	}
+	img.Partitions[0].Bootable = true
+	img.Partitions[0].MBRType = mbr.PartitionTypeFAT32LBA
+	l, err := img.Layout()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	_, err = img.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk := buf.Bytes()
+	bs, _ := mbr.ToBootSector(disk)
+	err = bs.Validate(uint32(l.NumSectors))
+	if err != nil {
+		t.Error(err)
+	}
+	it := bs.LogicalPartitions(bytes.NewReader(disk), 512)
+	i := 3
+	for it.Next() {
+		lp := it.Partition()
+		if int64(lp.StartLBA()) != l.Partitions[i].StartLBA {
+			t.Errorf("logical partition %d: expected start LBA %d, got %d", i, l.Partitions[i].StartLBA, lp.StartLBA())
+		}
+		i++
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	} else if i != len(img.Partitions) {
+		t.Errorf("expected %d logical partitions, got %d", len(img.Partitions)-3, i-3)
+	}
+	for i, e := range l.Partitions {
+		if disk[e.StartLBA*512] != byte(i+1) {
+			t.Errorf("partition %d content mismatch", i)
+		}
+	}
+}
+
+func TestImageHybrid(t *testing.T) {
+	img := Image{
+		Scheme: SchemeHybrid,
+		DiskID: 0xdeadbeef,
+		Partitions: []Partition{
+			{Name: "boot", Size: MiB, GPTType: gpt.PartitionTypeMicrosoftBasicData, MBRType: mbr.PartitionTypeFAT32LBA, Hybrid: true, Bootable: true},
+			{Name: "rootfs", Size: MiB, GPTType: gpt.PartitionTypeLinuxFilesystem},
+		},
+	}
+	var buf bytes.Buffer
+	_, err := img.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	disk := buf.Bytes()
+	_, err = gpt.ReadDisk(bytes.NewReader(disk), 512)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := mbr.ToBootSector(disk)
+	if !bs.IsGPTProtective() {
+		t.Error("expected protective entry")
+	}
+	if bs.UniqueDiskID() != img.DiskID {
+		t.Errorf("expected disk ID %#x, got %#x", img.DiskID, bs.UniqueDiskID())
+	}
+	boot := bs.PartitionTable(1)
+	if boot.PartitionType() != mbr.PartitionTypeFAT32LBA || boot.StartLBA() != MiB/512 || !boot.Attributes().IsBootable() {
+		t.Errorf("unexpected hybrid entry type=%#x start=%d", boot.PartitionType(), boot.StartLBA())
+	}
+	if rootfs := bs.PartitionTable(2); rootfs.PartitionType() != mbr.PartitionTypeUnused {
+		t.Error("expected non-hybrid partition to be left out of MBR")
+	}
+}
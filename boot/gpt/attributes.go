@@ -0,0 +1,146 @@
+package gpt
+
+import (
+	"strconv"
+	"strings"
+)
+
+// PartitionAttributes is the 64-bit attribute field of a partition entry. Bits 0..2 are defined
+// by the UEFI specification for all partitions, bits 48..63 are specific to the partition type.
+type PartitionAttributes uint64
+
+// Partition attributes defined by UEFI for all partition types.
+const (
+	// PartitionAttrRequired marks the partition as required for the platform to function. Partitioning tools should not delete it.
+	PartitionAttrRequired PartitionAttributes = 1 << 0
+	// PartitionAttrNoBlockIO tells firmware not to produce an EFI_BLOCK_IO_PROTOCOL for the partition.
+	PartitionAttrNoBlockIO PartitionAttributes = 1 << 1
+	// PartitionAttrLegacyBIOSBootable marks the partition as bootable by legacy BIOS firmware.
+	PartitionAttrLegacyBIOSBootable PartitionAttributes = 1 << 2
+
+	typeSpecificShift = 48
+)
+
+// Attributes specific to Microsoft basic data partitions ([PartitionTypeMicrosoftBasicData]).
+const (
+	PartitionAttrMicrosoftReadOnly    PartitionAttributes = 1 << 60
+	PartitionAttrMicrosoftShadowCopy  PartitionAttributes = 1 << 61
+	PartitionAttrMicrosoftHidden      PartitionAttributes = 1 << 62
+	PartitionAttrMicrosoftNoAutomount PartitionAttributes = 1 << 63 // No drive letter is assigned.
+)
+
+// Attributes specific to ChromeOS kernel partitions ([PartitionTypeChromeOSKernel]). Used by
+// ChromeOS and other A/B update schemes to select which kernel to boot.
+const (
+	chromeOSPriorityShift = 48
+	chromeOSTriesShift    = 52
+	chromeOSFieldMask     = 0xf
+	// PartitionAttrChromeOSSuccessful is set once the kernel has booted successfully.
+	PartitionAttrChromeOSSuccessful PartitionAttributes = 1 << 56
+)
+
+// IsRequired returns true if the partition is required for the platform to function.
+func (attrs PartitionAttributes) IsRequired() bool {
+	return attrs&PartitionAttrRequired != 0
+}
+
+// NoBlockIO returns true if firmware should not produce a block IO protocol for the partition.
+func (attrs PartitionAttributes) NoBlockIO() bool {
+	return attrs&PartitionAttrNoBlockIO != 0
+}
+
+// IsLegacyBIOSBootable returns true if the partition is bootable by legacy BIOS firmware.
+func (attrs PartitionAttributes) IsLegacyBIOSBootable() bool {
+	return attrs&PartitionAttrLegacyBIOSBootable != 0
+}
+
+// TypeSpecific returns bits 48..63 of the attributes whose meaning depends on the partition type.
+func (attrs PartitionAttributes) TypeSpecific() uint16 {
+	return uint16(attrs >> typeSpecificShift)
+}
+
+// SetTypeSpecific sets bits 48..63 of the attributes whose meaning depends on the partition type.
+func (attrs *PartitionAttributes) SetTypeSpecific(v uint16) {
+	*attrs = *attrs&(1<<typeSpecificShift-1) | PartitionAttributes(v)<<typeSpecificShift
+}
+
+// ChromeOSPriority returns the ChromeOS kernel priority (bits 48..51). Higher priority kernels
+// are tried first, 0 means the kernel is not bootable.
+func (attrs PartitionAttributes) ChromeOSPriority() uint8 {
+	return uint8(attrs>>chromeOSPriorityShift) & chromeOSFieldMask
+}
+
+// ChromeOSTries returns the number of boot attempts remaining for a ChromeOS kernel (bits 52..55).
+func (attrs PartitionAttributes) ChromeOSTries() uint8 {
+	return uint8(attrs>>chromeOSTriesShift) & chromeOSFieldMask
+}
+
+// ChromeOSSuccessful returns true if the ChromeOS kernel has booted successfully (bit 56).
+func (attrs PartitionAttributes) ChromeOSSuccessful() bool {
+	return attrs&PartitionAttrChromeOSSuccessful != 0
+}
+
+// SetChromeOS sets the ChromeOS kernel priority, tries remaining and successful fields. priority
+// and tries are 4 bit fields, values above 15 are truncated.
+func (attrs *PartitionAttributes) SetChromeOS(priority, tries uint8, successful bool) {
+	const mask = chromeOSFieldMask<<chromeOSPriorityShift | chromeOSFieldMask<<chromeOSTriesShift | PartitionAttrChromeOSSuccessful
+	v := *attrs &^ mask
+	v |= PartitionAttributes(priority&chromeOSFieldMask) << chromeOSPriorityShift
+	v |= PartitionAttributes(tries&chromeOSFieldMask) << chromeOSTriesShift
+	if successful {
+		v |= PartitionAttrChromeOSSuccessful
+	}
+	*attrs = v
+}
+
+// String returns a human readable representation of the UEFI defined attributes
+// followed by the type specific bits in hexadecimal. To decode the type specific bits
+// use [PartitionAttributes.StringForType].
+func (attrs PartitionAttributes) String() string {
+	return attrs.StringForType(PartitionTypeUnused)
+}
+
+// StringForType is like [PartitionAttributes.String] but decodes the type specific bits
+// for Microsoft basic data and ChromeOS kernel partition types.
+func (attrs PartitionAttributes) StringForType(partitionType GUID) string {
+	var names []string
+	if attrs.IsRequired() {
+		names = append(names, "required")
+	}
+	if attrs.NoBlockIO() {
+		names = append(names, "no-block-io")
+	}
+	if attrs.IsLegacyBIOSBootable() {
+		names = append(names, "legacy-bios-bootable")
+	}
+	if reserved := attrs & (1<<typeSpecificShift - 1) &^ 0b111; reserved != 0 {
+		names = append(names, "reserved=0x"+strconv.FormatUint(uint64(reserved), 16))
+	}
+	switch {
+	case attrs.TypeSpecific() == 0:
+		// Nothing to add.
+	case partitionType == PartitionTypeMicrosoftBasicData:
+		msNames := [...]string{"read-only", "shadow-copy", "hidden", "no-automount"}
+		for i, name := range msNames {
+			if attrs&(PartitionAttrMicrosoftReadOnly<<i) != 0 {
+				names = append(names, name)
+			}
+		}
+		if other := attrs.TypeSpecific() & 0x0fff; other != 0 {
+			names = append(names, "type=0x"+strconv.FormatUint(uint64(other), 16))
+		}
+	case partitionType == PartitionTypeChromeOSKernel:
+		names = append(names, "priority="+strconv.Itoa(int(attrs.ChromeOSPriority())),
+			"tries="+strconv.Itoa(int(attrs.ChromeOSTries())),
+			"successful="+strconv.FormatBool(attrs.ChromeOSSuccessful()))
+		if other := attrs.TypeSpecific() &^ 0x1ff; other != 0 {
+			names = append(names, "type=0x"+strconv.FormatUint(uint64(other), 16))
+		}
+	default:
+		names = append(names, "type=0x"+strconv.FormatUint(uint64(attrs.TypeSpecific()), 16))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
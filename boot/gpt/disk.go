@@ -0,0 +1,186 @@
+package gpt
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+
+	"github.com/soypat/tinyboot/boot/mbr"
+)
+
+const (
+	// Signature is the magic number at the start of every GPT header: "EFI PART" in little-endian.
+	Signature = 0x5452415020494645
+	// Revision1 is the GPT header revision used by UEFI 2.x, written as [0,0,1,0].
+	Revision1 = 0x00010000
+	// HeaderSize is the size of the GPT header defined by UEFI 2.x. Larger headers are allowed, the extra bytes are reserved.
+	HeaderSize = 92
+	// PartitionEntrySize is the minimum and usual size of a partition entry.
+	PartitionEntrySize = 128
+
+	// maxEntryArraySize limits the partition entry array size read from disk to avoid huge allocations on corrupt headers.
+	maxEntryArraySize = 1 << 20
+)
+
+var (
+	errBadSignature  = errors.New("gpt header signature is not \"EFI PART\"")
+	errHeaderCRC     = errors.New("gpt header CRC mismatch")
+	errEntriesCRC    = errors.New("gpt partition entry array CRC mismatch")
+	errBadSectorSize = errors.New("sector size must be a power of two and at least 512")
+)
+
+// Disk is a GUID Partition Table as read from a disk. It contains both the primary
+// and backup tables so that callers can choose which copy to trust.
+type Disk struct {
+	// SectorSize is the logical block size of the disk in bytes.
+	SectorSize int
+	// ProtectiveMBR is the Master Boot Record found at LBA 0.
+	ProtectiveMBR mbr.BootSector
+	// Primary is the table whose header is found at LBA 1.
+	Primary Table
+	// Backup is the table whose header is found at the primary header's BackupLBA.
+	// If the primary header is corrupt the backup location is taken from the protective MBR.
+	Backup Table
+}
+
+// Table is a GPT header and its partition entry array.
+type Table struct {
+	Header Header
+	// Entries contains all entries of the partition entry array, including unused ones.
+	Entries []PartitionEntry
+	// Err is nil if the header and partition entry array passed validation, i.e: signature and both CRCs match.
+	Err error
+	// entries is the raw partition entry array.
+	entries []byte
+}
+
+// Healthy returns the first table that passed validation, primary first. If neither
+// the primary nor backup tables are valid an error containing both failures is returned.
+func (d *Disk) Healthy() (*Table, error) {
+	if d.Primary.Err == nil {
+		return &d.Primary, nil
+	} else if d.Backup.Err == nil {
+		return &d.Backup, nil
+	}
+	return nil, fmt.Errorf("no healthy GPT: primary: %w; backup: %w", d.Primary.Err, d.Backup.Err)
+}
+
+// ReadDisk reads the protective MBR, the primary GPT header and partition entry array at LBA 1
+// and the backup header and partition entry array located at the primary header's BackupLBA.
+// Both copies are validated and the result, including any error reading the copy, is stored
+// in each [Table]'s Err field. ReadDisk only returns an error on bad arguments, failure to read
+// the protective MBR or if neither copy is healthy, in which case the partially read disk is
+// still returned for inspection.
+func ReadDisk(r io.ReaderAt, sectorSize int) (*Disk, error) {
+	if sectorSize < 512 || sectorSize&(sectorSize-1) != 0 {
+		return nil, errBadSectorSize
+	}
+	sector := make([]byte, sectorSize)
+	_, err := r.ReadAt(sector, 0)
+	if err != nil {
+		return nil, fmt.Errorf("reading protective MBR: %w", err)
+	}
+	bs, err := mbr.ToBootSector(sector)
+	if err != nil {
+		return nil, err
+	}
+	d := &Disk{
+		SectorSize:    sectorSize,
+		ProtectiveMBR: bs,
+	}
+	err = d.Primary.read(r, sectorSize, 1)
+	if err != nil {
+		d.Primary.Err = fmt.Errorf("reading primary GPT: %w", err)
+	}
+	var backupLBA int64
+	if d.Primary.Err == nil {
+		backupLBA = d.Primary.Header.BackupLBA()
+	} else {
+		// Protective MBR partition spans from LBA 1 to the last LBA of the disk, where the backup header lives.
+		pte := bs.PartitionTable(0)
+		backupLBA = int64(pte.StartLBA()) + int64(pte.NumberOfLBA()) - 1
+	}
+	if backupLBA <= 1 {
+		d.Backup.Err = fmt.Errorf("invalid backup LBA %d", backupLBA)
+	} else {
+		err = d.Backup.read(r, sectorSize, backupLBA)
+		if err != nil {
+			d.Backup.Err = fmt.Errorf("reading backup GPT: %w", err)
+		}
+	}
+	if d.Backup.Err == nil && d.Backup.Header.BackupLBA() != 1 {
+		d.Backup.Err = fmt.Errorf("backup header points to alternate LBA %d, expected 1", d.Backup.Header.BackupLBA())
+	}
+	_, err = d.Healthy()
+	if err != nil {
+		return d, err
+	}
+	return d, nil
+}
+
+// read reads the header at lba and its partition entry array. Validation errors are stored in t.Err.
+func (t *Table) read(r io.ReaderAt, sectorSize int, lba int64) error {
+	sector := make([]byte, sectorSize)
+	_, err := r.ReadAt(sector, lba*int64(sectorSize))
+	if err != nil {
+		return err
+	}
+	t.Header, _ = ToHeader(sector)
+	t.Err = validateHeader(sector, lba)
+	if t.Err != nil {
+		return nil
+	}
+	h := t.Header
+	entsz := int64(h.SizeOfPartitionEntry())
+	arraySize := int64(h.NumberOfPartitionEntries()) * entsz
+	t.entries = make([]byte, arraySize)
+	_, err = r.ReadAt(t.entries, h.PartitionEntryLBA()*int64(sectorSize))
+	if err != nil {
+		return err
+	}
+	if crc32.ChecksumIEEE(t.entries) != h.CRCOfPartitionEntries() {
+		t.Err = errEntriesCRC
+	}
+	t.Entries = make([]PartitionEntry, h.NumberOfPartitionEntries())
+	for i := range t.Entries {
+		t.Entries[i], _ = ToPartitionEntry(t.entries[int64(i)*entsz:])
+	}
+	return nil
+}
+
+// validateHeader checks the header in sector read from lba for consistency. It
+// does not validate the partition entry array.
+func validateHeader(sector []byte, lba int64) error {
+	h, err := ToHeader(sector)
+	if err != nil {
+		return err
+	}
+	size := h.Size()
+	entsz := h.SizeOfPartitionEntry()
+	switch {
+	case h.Signature() != Signature:
+		return errBadSignature
+	case size < HeaderSize || int(size) > len(sector):
+		return fmt.Errorf("invalid gpt header size %d", size)
+	case headerCRC(sector[:size]) != h.CRC():
+		return errHeaderCRC
+	case h.CurrentLBA() != lba:
+		return fmt.Errorf("gpt header at LBA %d reports current LBA %d", lba, h.CurrentLBA())
+	case entsz < PartitionEntrySize || entsz%PartitionEntrySize != 0:
+		return fmt.Errorf("invalid partition entry size %d", entsz)
+	case uint64(entsz)*uint64(h.NumberOfPartitionEntries()) > maxEntryArraySize:
+		return errors.New("partition entry array too large")
+	case h.FirstUsableLBA() > h.LastUsableLBA()+1:
+		return fmt.Errorf("first usable LBA %d past last usable LBA %d", h.FirstUsableLBA(), h.LastUsableLBA())
+	}
+	return nil
+}
+
+// headerCRC computes the CRC32 of a GPT header of len(hdr) bytes as if the CRC field was zero.
+func headerCRC(hdr []byte) uint32 {
+	var zero [4]byte
+	crc := crc32.Update(0, crc32.IEEETable, hdr[:16])
+	crc = crc32.Update(crc, crc32.IEEETable, zero[:])
+	return crc32.Update(crc, crc32.IEEETable, hdr[20:])
+}
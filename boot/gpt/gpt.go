@@ -6,6 +6,7 @@ package gpt
 import (
 	"encoding/binary"
 	"errors"
+	"hash/crc32"
 
 	"github.com/soypat/tinyboot/internal/utf16x"
 )
@@ -35,11 +36,21 @@ func (h Header) Signature() (sig uint64) {
 	return binary.LittleEndian.Uint64(h.data[0:8])
 }
 
+// SetSignature sets the 8-byte signature at the start of the GPT header. Use [Signature] for a valid header.
+func (h Header) SetSignature(sig uint64) {
+	binary.LittleEndian.PutUint64(h.data[0:8], sig)
+}
+
 // Revision returns the GPT Header revision number. [0,0,1,0] for UEFI 2.10.
 func (h Header) Revision() uint32 {
 	return binary.LittleEndian.Uint32(h.data[8:12])
 }
 
+// SetRevision sets the GPT Header revision number. Use [Revision1] for UEFI 2.x headers.
+func (h Header) SetRevision(rev uint32) {
+	binary.LittleEndian.PutUint32(h.data[8:12], rev)
+}
+
 // Size returns the size of the GPT header in bytes, usually 92.
 func (h Header) Size() uint32 {
 	return binary.LittleEndian.Uint32(h.data[12:16])
@@ -60,6 +71,24 @@ func (h Header) SetCRC(crc uint32) {
 	binary.LittleEndian.PutUint32(h.data[16:20], crc)
 }
 
+// ComputeCRC computes the CRC32 of the GPT header as if the CRC field were zero. Header bytes
+// past the first 92 up to [Header.Size] are reserved and taken to be zero.
+func (h Header) ComputeCRC() uint32 {
+	crc := headerCRC(h.data)
+	size := int(h.Size())
+	if size > len(h.data) {
+		var zeros [64]byte
+		for n := size - len(h.data); n > 0; n -= len(zeros) {
+			if n < len(zeros) {
+				crc = crc32.Update(crc, crc32.IEEETable, zeros[:n])
+			} else {
+				crc = crc32.Update(crc, crc32.IEEETable, zeros[:])
+			}
+		}
+	}
+	return crc
+}
+
 // Bytes 20..24 are reserved and should be zero.
 
 // CurrentLBA returns the LBA of the current GPT header.
@@ -103,13 +132,13 @@ func (h Header) SetLastUsableLBA(lba int64) {
 }
 
 // DiskGUID returns the GUID of the disk.
-func (h Header) DiskGUID() (guid [16]byte) {
+func (h Header) DiskGUID() (guid GUID) {
 	copy(guid[:], h.data[56:72])
 	return guid
 }
 
 // SetDiskGUID sets the GUID of the disk.
-func (h Header) SetDiskGUID(guid [16]byte) {
+func (h Header) SetDiskGUID(guid GUID) {
 	copy(h.data[56:72], guid[:])
 }
 
@@ -161,7 +190,17 @@ type PartitionEntry struct {
 	data []byte
 }
 
-type PartitionAttributes uint64
+// MakePartitionEntry creates a new partition entry with its own backing memory from the given parameters.
+// The name can be set with [PartitionEntry.SetNameUTF8].
+func MakePartitionEntry(typeGUID, uniqueGUID GUID, firstLBA, lastLBA int64, attrs PartitionAttributes) PartitionEntry {
+	p := PartitionEntry{data: make([]byte, PartitionEntrySize)}
+	p.SetPartitionTypeGUID(typeGUID)
+	p.SetUniquePartitionGUID(uniqueGUID)
+	p.SetFirstLBA(firstLBA)
+	p.SetLastLBA(lastLBA)
+	p.SetAttributes(attrs)
+	return p
+}
 
 func ToPartitionEntry(start []byte) (PartitionEntry, error) {
 	if len(start) < 128 {
@@ -174,24 +213,29 @@ func ToPartitionEntry(start []byte) (PartitionEntry, error) {
 }
 
 // PartitionTypeGUID returns the GUID of the partition type.
-func (p PartitionEntry) PartitionTypeGUID() (guid [16]byte) {
+func (p PartitionEntry) PartitionTypeGUID() (guid GUID) {
 	copy(guid[:], p.data[0:16])
 	return
 }
 
 // SetPartitionTypeGUID sets the GUID of the partition type.
-func (p PartitionEntry) SetPartitionTypeGUID(guid [16]byte) {
+func (p PartitionEntry) SetPartitionTypeGUID(guid GUID) {
 	copy(p.data[0:16], guid[:])
 }
 
+// IsUsed returns true if the partition type GUID is not zero, which marks an unused entry.
+func (p PartitionEntry) IsUsed() bool {
+	return !p.PartitionTypeGUID().IsZero()
+}
+
 // UniquePartitionGUID returns the GUID of the partition.
-func (p PartitionEntry) UniquePartitionGUID() (guid [16]byte) {
+func (p PartitionEntry) UniquePartitionGUID() (guid GUID) {
 	copy(guid[:], p.data[16:32])
 	return
 }
 
 // SetUniquePartitionGUID sets the GUID of the partition.
-func (p PartitionEntry) SetUniquePartitionGUID(guid [16]byte) {
+func (p PartitionEntry) SetUniquePartitionGUID(guid GUID) {
 	copy(p.data[16:32], guid[:])
 }
 
@@ -231,10 +275,10 @@ func (p PartitionEntry) SetAttributes(attr PartitionAttributes) {
 // encodes it as utf-8 into the provided slice. The number of bytes
 // read is returned along with any error.
 func (p PartitionEntry) ReadNameAsUTF8(b []byte) (int, error) {
-	// Find the length of the name.
+	// Find the length of the name by looking for the UTF-16 null terminator.
 	nameLen := 0
-	for nameLen < pteNameLen && p.data[pteNameOff+nameLen] != 0 {
-		nameLen++
+	for nameLen < pteNameLen && (p.data[pteNameOff+nameLen] != 0 || p.data[pteNameOff+nameLen+1] != 0) {
+		nameLen += 2
 	}
 
 	n, err := utf16x.ToUTF8(b, p.data[pteNameOff:pteNameOff+nameLen], binary.LittleEndian)
@@ -0,0 +1,373 @@
+package gpt
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/soypat/tinyboot/boot/mbr"
+)
+
+const testSectorSize = 512
+
+func TestReadDisk(t *testing.T) {
+	const numSectors = 4096
+	disk := makeTestDisk(t, numSectors)
+	d, err := ReadDisk(bytes.NewReader(disk), testSectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Primary.Err != nil || d.Backup.Err != nil {
+		t.Fatalf("expected healthy tables, got primary=%v backup=%v", d.Primary.Err, d.Backup.Err)
+	}
+	if !d.ProtectiveMBR.IsGPTProtective() {
+		t.Error("expected protective MBR")
+	}
+	if d.Backup.Header.CurrentLBA() != numSectors-1 {
+		t.Errorf("expected backup at last LBA, got %d", d.Backup.Header.CurrentLBA())
+	}
+	var name [36]byte
+	n, err := d.Primary.Entries[0].ReadNameAsUTF8(name[:])
+	if err != nil {
+		t.Fatal(err)
+	} else if string(name[:n]) != "boot" {
+		t.Errorf("expected partition name %q, got %q", "boot", name[:n])
+	}
+
+	// Corrupt primary header, backup should be found through protective MBR.
+	disk[testSectorSize+30] ^= 0xff
+	d, err = ReadDisk(bytes.NewReader(disk), testSectorSize)
+	if err != nil {
+		t.Fatal(err)
+	} else if d.Primary.Err != errHeaderCRC {
+		t.Errorf("expected primary header CRC error, got %v", d.Primary.Err)
+	}
+	tbl, err := d.Healthy()
+	if err != nil {
+		t.Fatal(err)
+	} else if tbl != &d.Backup {
+		t.Error("expected backup table to be healthy")
+	}
+
+	// Corrupt backup entry array.
+	disk[(numSectors-33)*testSectorSize] ^= 0xff
+	_, err = ReadDisk(bytes.NewReader(disk), testSectorSize)
+	if err == nil {
+		t.Error("expected error with both tables corrupt")
+	}
+}
+
+func TestReadDiskTruncated(t *testing.T) {
+	const numSectors = 4096
+	disk := makeTestDisk(t, numSectors)
+	// Truncate before the backup partition entry array and header.
+	disk = disk[:(numSectors-34)*testSectorSize]
+	d, err := ReadDisk(bytes.NewReader(disk), testSectorSize)
+	if err != nil {
+		t.Fatal(err)
+	} else if d.Primary.Err != nil {
+		t.Errorf("expected healthy primary, got %v", d.Primary.Err)
+	} else if !errors.Is(d.Backup.Err, io.EOF) {
+		t.Errorf("expected backup read error, got %v", d.Backup.Err)
+	}
+	tbl, err := d.Healthy()
+	if err != nil {
+		t.Fatal(err)
+	} else if tbl != &d.Primary {
+		t.Error("expected primary table to be healthy")
+	}
+
+	// Truncate before the primary partition entry array, neither copy is readable.
+	_, err = ReadDisk(bytes.NewReader(disk[:2*testSectorSize]), testSectorSize)
+	if err == nil {
+		t.Error("expected error with both tables unreadable")
+	}
+}
+
+func TestWriteDisk(t *testing.T) {
+	const numSectors = 4096
+	fp, err := os.Create(filepath.Join(t.TempDir(), "gpt.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	err = fp.Truncate(numSectors * testSectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := DiskConfig{SectorSize: testSectorSize, NumSectors: numSectors}
+	first, last := cfg.UsableLBAs()
+	pe := MakePartitionEntry([16]byte{1, 2, 3}, [16]byte{}, 2048, last+1, 0)
+	pe.SetNameUTF8([]byte("boot"))
+	err = WriteDisk(fp, cfg, []PartitionEntry{pe})
+	if err == nil {
+		t.Fatal("expected error for partition past usable LBAs")
+	}
+	pe.SetLastLBA(last)
+	err = WriteDisk(fp, cfg, []PartitionEntry{pe, MakePartitionEntry([16]byte{1}, [16]byte{}, first, 2048, 0)})
+	if err == nil {
+		t.Fatal("expected error for overlapping partitions")
+	}
+	err = WriteDisk(fp, cfg, []PartitionEntry{pe})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ReadDisk(fp, testSectorSize)
+	if err != nil {
+		t.Fatal(err)
+	} else if d.Primary.Err != nil || d.Backup.Err != nil {
+		t.Fatalf("expected healthy tables, got primary=%v backup=%v", d.Primary.Err, d.Backup.Err)
+	}
+	got := make([]byte, numSectors*testSectorSize)
+	_, err = fp.ReadAt(got, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := makeTestDisk(t, numSectors)
+	if !bytes.Equal(got[testSectorSize:], want[testSectorSize:]) {
+		t.Error("written GPT does not match hand-built GPT")
+	}
+}
+
+// makeTestDisk builds a GPT disk by hand with a single partition.
+func makeTestDisk(t *testing.T, numSectors int64) []byte {
+	const numEntries = 128
+	const entryArraySectors = numEntries * PartitionEntrySize / testSectorSize
+	disk := make([]byte, numSectors*testSectorSize)
+	bs, _ := mbr.ToBootSector(disk)
+	bs.SetPartitionTable(0, mbr.MakePartitionTableEntry(0, mbr.PartitionTypeGPTProtective, 1, uint32(numSectors-1), mbr.NewCHS(0, 0, 2), mbr.NewCHS(1023, 255, 63)))
+	disk[510] = 0x55
+	disk[511] = 0xaa
+
+	entries := disk[2*testSectorSize : (2+entryArraySectors)*testSectorSize]
+	pe, _ := ToPartitionEntry(entries)
+	pe.SetPartitionTypeGUID([16]byte{1, 2, 3})
+	pe.SetFirstLBA(2048)
+	pe.SetLastLBA(numSectors - 34)
+	err := pe.SetNameUTF8([]byte("boot"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	backupEntriesLBA := numSectors - 1 - entryArraySectors
+	copy(disk[backupEntriesLBA*testSectorSize:], entries)
+	for _, lbas := range [][3]int64{{1, numSectors - 1, 2}, {numSectors - 1, 1, backupEntriesLBA}} {
+		h, _ := ToHeader(disk[lbas[0]*testSectorSize:])
+		copy(h.data, "EFI PART")
+		h.data[10] = 1 // Revision 1.0.
+		h.SetSize(HeaderSize)
+		h.SetCurrentLBA(lbas[0])
+		h.SetBackupLBA(lbas[1])
+		h.SetFirstUsableLBA(2 + entryArraySectors)
+		h.SetLastUsableLBA(numSectors - 2 - entryArraySectors)
+		h.SetPartitionEntryLBA(lbas[2])
+		h.SetNumberOfPartitionEntries(numEntries)
+		h.SetSizeOfPartitionEntry(PartitionEntrySize)
+		h.SetCRCOfPartitionEntries(crc32.ChecksumIEEE(entries))
+		h.SetCRC(crc32.ChecksumIEEE(h.data))
+	}
+	return disk
+}
+
+func TestGUID(t *testing.T) {
+	const efiStr = "C12A7328-F81F-11D2-BA4B-00A0C93EC93B"
+	efiDisk := GUID{0x28, 0x73, 0x2a, 0xc1, 0x1f, 0xf8, 0xd2, 0x11, 0xba, 0x4b, 0x00, 0xa0, 0xc9, 0x3e, 0xc9, 0x3b}
+	g, err := ParseGUID("c12a7328-f81f-11d2-ba4b-00a0c93ec93b")
+	if err != nil {
+		t.Fatal(err)
+	} else if g != efiDisk {
+		t.Errorf("mixed-endian mismatch: got % x, want % x", g[:], efiDisk[:])
+	}
+	if g.String() != efiStr {
+		t.Errorf("expected %s, got %s", efiStr, g.String())
+	}
+	name, ok := PartitionTypeName(g)
+	if !ok || name != "EFI system" {
+		t.Errorf("expected EFI system partition type name, got %q", name)
+	}
+	_, err = ParseGUID("C12A7328F81F-11D2-BA4B-00A0C93EC93B0")
+	if err == nil {
+		t.Error("expected error parsing malformed GUID")
+	}
+}
+
+func TestPartitionAttributes(t *testing.T) {
+	attrs := PartitionAttrRequired | PartitionAttrLegacyBIOSBootable
+	attrs.SetChromeOS(15, 3, true)
+	if attrs.ChromeOSPriority() != 15 || attrs.ChromeOSTries() != 3 || !attrs.ChromeOSSuccessful() {
+		t.Errorf("ChromeOS fields mismatch: %s", attrs.StringForType(PartitionTypeChromeOSKernel))
+	}
+	if !attrs.IsRequired() || attrs.NoBlockIO() || !attrs.IsLegacyBIOSBootable() {
+		t.Errorf("UEFI fields mismatch: %s", attrs)
+	}
+	const wantCrOS = "required|legacy-bios-bootable|priority=15|tries=3|successful=true"
+	if got := attrs.StringForType(PartitionTypeChromeOSKernel); got != wantCrOS {
+		t.Errorf("expected %q, got %q", wantCrOS, got)
+	}
+	attrs.SetChromeOS(1, 0, false)
+	if attrs.TypeSpecific() != 1 {
+		t.Errorf("expected type specific bits 0x1, got %#x", attrs.TypeSpecific())
+	}
+	attrs = PartitionAttrMicrosoftHidden | PartitionAttrMicrosoftNoAutomount
+	const wantMS = "hidden|no-automount"
+	if got := attrs.StringForType(PartitionTypeMicrosoftBasicData); got != wantMS {
+		t.Errorf("expected %q, got %q", wantMS, got)
+	}
+	if got := attrs.String(); got != "type=0xc000" {
+		t.Errorf("expected raw type specific bits, got %q", got)
+	}
+}
+
+func TestHybridMBR(t *testing.T) {
+	entries := []PartitionEntry{
+		MakePartitionEntry(PartitionTypeMicrosoftBasicData, GUID{1}, 2048, 4095, 0),
+		MakePartitionEntry(PartitionTypeLinuxFilesystem, GUID{2}, 4096, 8191, 0),
+	}
+	bs, _ := mbr.ToBootSector(make([]byte, 512))
+	err := MakeHybridMBR(bs, entries, []HybridPartition{{Index: 0, Type: mbr.PartitionTypeFAT32LBA, Bootable: true}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bs.IsHybrid() || !bs.IsGPTProtective() {
+		t.Error("expected hybrid MBR with protective first entry")
+	}
+	err = ValidateHybridMBR(bs, entries)
+	if err != nil {
+		t.Error(err)
+	}
+	err = bs.Validate(8192 + 34)
+	if err != nil {
+		t.Error(err)
+	}
+	bs.SetPartitionTable(0, mbr.MakePartitionTableEntryLBA(0, mbr.PartitionTypeGPTProtective, 2, 2046))
+	err = ValidateHybridMBR(bs, entries)
+	if err == nil {
+		t.Error("expected error for protective entry not covering GPT header")
+	}
+	bs.SetPartitionTable(0, mbr.MakePartitionTableEntryLBA(0, mbr.PartitionTypeGPTProtective, 1, 2047))
+	err = ValidateHybridMBR(bs, entries)
+	if err != nil {
+		t.Error(err)
+	}
+	entries[0].SetLastLBA(3000)
+	err = ValidateHybridMBR(bs, entries)
+	if err == nil {
+		t.Error("expected mismatch between hybrid MBR and GPT")
+	}
+}
+
+func TestResizeDisk(t *testing.T) {
+	const oldSectors, newSectors = 4096, 10000
+	fp, err := os.Create(filepath.Join(t.TempDir(), "gpt.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	disk := makeTestDisk(t, oldSectors)
+	_, err = fp.WriteAt(disk, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fp.Truncate(newSectors * testSectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ReadDisk(fp, testSectorSize)
+	if err != nil {
+		t.Fatal(err) // Backup is still in the middle of the disk and healthy.
+	}
+	err = ResizeDisk(fp, testSectorSize, newSectors, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ReadDisk(fp, testSectorSize)
+	if err != nil {
+		t.Fatal(err)
+	} else if d.Primary.Err != nil || d.Backup.Err != nil {
+		t.Fatalf("expected healthy tables, got primary=%v backup=%v", d.Primary.Err, d.Backup.Err)
+	}
+	const wantLastUsable = newSectors - 34
+	if d.Backup.Header.CurrentLBA() != newSectors-1 {
+		t.Errorf("expected backup header at LBA %d, got %d", newSectors-1, d.Backup.Header.CurrentLBA())
+	}
+	for _, tbl := range []*Table{&d.Primary, &d.Backup} {
+		if tbl.Header.LastUsableLBA() != wantLastUsable {
+			t.Errorf("expected last usable LBA %d, got %d", wantLastUsable, tbl.Header.LastUsableLBA())
+		} else if tbl.Entries[0].LastLBA() != wantLastUsable {
+			t.Errorf("expected last partition grown to %d, got %d", wantLastUsable, tbl.Entries[0].LastLBA())
+		}
+	}
+	if pte := d.ProtectiveMBR.PartitionTable(0); pte.NumberOfLBA() != newSectors-1 {
+		t.Errorf("expected protective MBR to span %d sectors, got %d", newSectors-1, pte.NumberOfLBA())
+	}
+	err = ResizeDisk(fp, testSectorSize, oldSectors, false)
+	if err == nil {
+		t.Error("expected error shrinking disk past last partition")
+	}
+	err = ResizeDisk(fp, testSectorSize, oldSectors, true)
+	if err == nil {
+		t.Error("expected error shrinking disk past last partition with growLast")
+	}
+	err = ResizeDisk(fp, testSectorSize, 2000, true)
+	if err == nil {
+		t.Error("expected error growing last partition that starts past new last usable LBA")
+	}
+}
+
+func TestResizeDiskRepair(t *testing.T) {
+	const oldSectors, newSectors = 4096, 10000
+	fp, err := os.Create(filepath.Join(t.TempDir(), "gpt.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	disk := makeTestDisk(t, oldSectors)
+	disk[testSectorSize+30] ^= 0xff // Corrupt primary header.
+	_, err = fp.WriteAt(disk, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = fp.Truncate(newSectors * testSectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ResizeDisk(fp, testSectorSize, newSectors, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := ReadDisk(fp, testSectorSize)
+	if err != nil {
+		t.Fatal(err)
+	} else if d.Primary.Err != nil || d.Backup.Err != nil {
+		t.Fatalf("expected repaired tables, got primary=%v backup=%v", d.Primary.Err, d.Backup.Err)
+	} else if d.Primary.Header.PartitionEntryLBA() != 2 {
+		t.Errorf("expected primary partition entry array at LBA 2, got %d", d.Primary.Header.PartitionEntryLBA())
+	} else if d.Backup.Header.PartitionEntryLBA() != newSectors-33 {
+		t.Errorf("expected backup partition entry array at LBA %d, got %d", newSectors-33, d.Backup.Header.PartitionEntryLBA())
+	}
+}
+
+func TestPartitionEntryName(t *testing.T) {
+	var buf [128]byte
+	pe, err := ToPartitionEntry(buf[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Ā (U+0100) is encoded with a zero low byte in UTF-16LE, which must not be taken as the terminator.
+	for _, want := range []string{"boot", "Āb", "EFI system partition"} {
+		err = pe.SetNameUTF8([]byte(want))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var name [72]byte
+		n, err := pe.ReadNameAsUTF8(name[:])
+		if err != nil {
+			t.Fatal(err)
+		} else if string(name[:n]) != want {
+			t.Errorf("expected partition name %q, got %q", want, name[:n])
+		}
+	}
+}
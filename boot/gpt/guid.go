@@ -0,0 +1,145 @@
+package gpt
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// GUID is a globally unique identifier as stored on disk. The first three fields of its canonical
+// XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX form are stored little-endian and the last two big-endian,
+// which is known as mixed-endian encoding.
+type GUID [16]byte
+
+// Well known partition type GUIDs.
+// See https://en.wikipedia.org/wiki/GUID_Partition_Table#Partition_type_GUIDs for more.
+var (
+	PartitionTypeUnused             = GUID{}
+	PartitionTypeEFISystem          = MustParseGUID("C12A7328-F81F-11D2-BA4B-00A0C93EC93B")
+	PartitionTypeMBRScheme          = MustParseGUID("024DEE41-33E7-11D3-9D69-0008C781F39F")
+	PartitionTypeBIOSBoot           = MustParseGUID("21686148-6449-6E6F-744E-656564454649")
+	PartitionTypeMicrosoftReserved  = MustParseGUID("E3C9E316-0B5C-4DB8-817D-F92DF00215AE")
+	PartitionTypeMicrosoftBasicData = MustParseGUID("EBD0A0A2-B9E5-4433-87C0-68B6B72699C7")
+	PartitionTypeWindowsRecovery    = MustParseGUID("DE94BBA4-06D1-4D40-A16A-BFD50179D6AC")
+	PartitionTypeLinuxFilesystem    = MustParseGUID("0FC63DAF-8483-4772-8E79-3D69D8477DE4")
+	PartitionTypeLinuxSwap          = MustParseGUID("0657FD6D-A4AB-43C4-84E5-0933C84B4F4F")
+	PartitionTypeLinuxLVM           = MustParseGUID("E6D6D379-F507-44C2-A23C-238F2A3DF928")
+	PartitionTypeLinuxRAID          = MustParseGUID("A19D880F-05FC-4D3B-A006-743F0F84911E")
+	PartitionTypeLinuxHome          = MustParseGUID("933AC7E1-2EB4-4F13-B844-0E14E2AEF915")
+	PartitionTypeLinuxExtBoot       = MustParseGUID("BC13C2FF-59E6-4262-A352-B275FD6F7172")
+	PartitionTypeLinuxRootX86_64    = MustParseGUID("4F68BCE3-E8CD-4DB1-96E7-FBCAF984B709")
+	PartitionTypeLinuxRootARM64     = MustParseGUID("B921B045-1DF0-41C3-AF44-4C6F280D3FAE")
+	PartitionTypeChromeOSKernel     = MustParseGUID("FE3A2A5D-4F32-41A7-B725-ACCC3285A309")
+	PartitionTypeChromeOSRootfs     = MustParseGUID("3CB8E202-3B7E-47DD-8A3C-7FF2A13CFCEC")
+	PartitionTypeChromeOSFirmware   = MustParseGUID("CAB6E88E-ABF3-4102-A07A-D4BB9BE3C1D3")
+	PartitionTypeChromeOSReserved   = MustParseGUID("2E0A753D-9E48-43B0-8337-B15192CB1B5E")
+	PartitionTypeAppleHFS           = MustParseGUID("48465300-0000-11AA-AA11-00306543ECAC")
+	PartitionTypeAppleAPFS          = MustParseGUID("7C3457EF-0000-11AA-AA11-00306543ECAC")
+	PartitionTypeFreeBSDUFS         = MustParseGUID("516E7CB6-6ECF-11D6-8FF8-00022D09712B")
+)
+
+var partitionTypeNames = []struct {
+	guid GUID
+	name string
+}{
+	{PartitionTypeUnused, "unused"},
+	{PartitionTypeEFISystem, "EFI system"},
+	{PartitionTypeMBRScheme, "MBR partition scheme"},
+	{PartitionTypeBIOSBoot, "BIOS boot"},
+	{PartitionTypeMicrosoftReserved, "Microsoft reserved"},
+	{PartitionTypeMicrosoftBasicData, "Microsoft basic data"},
+	{PartitionTypeWindowsRecovery, "Windows recovery"},
+	{PartitionTypeLinuxFilesystem, "Linux filesystem"},
+	{PartitionTypeLinuxSwap, "Linux swap"},
+	{PartitionTypeLinuxLVM, "Linux LVM"},
+	{PartitionTypeLinuxRAID, "Linux RAID"},
+	{PartitionTypeLinuxHome, "Linux home"},
+	{PartitionTypeLinuxExtBoot, "Linux extended boot"},
+	{PartitionTypeLinuxRootX86_64, "Linux root (x86-64)"},
+	{PartitionTypeLinuxRootARM64, "Linux root (ARM64)"},
+	{PartitionTypeChromeOSKernel, "ChromeOS kernel"},
+	{PartitionTypeChromeOSRootfs, "ChromeOS rootfs"},
+	{PartitionTypeChromeOSFirmware, "ChromeOS firmware"},
+	{PartitionTypeChromeOSReserved, "ChromeOS reserved"},
+	{PartitionTypeAppleHFS, "Apple HFS+"},
+	{PartitionTypeAppleAPFS, "Apple APFS"},
+	{PartitionTypeFreeBSDUFS, "FreeBSD UFS"},
+}
+
+// PartitionTypeName returns the name of a well known partition type GUID. If the GUID is
+// not known ok is false.
+func PartitionTypeName(g GUID) (name string, ok bool) {
+	for _, pt := range partitionTypeNames {
+		if pt.guid == g {
+			return pt.name, true
+		}
+	}
+	return "", false
+}
+
+// ParseGUID parses a GUID in its canonical XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX form. Hex digits may be upper or lower case.
+func ParseGUID(s string) (g GUID, err error) {
+	if len(s) != 36 || s[8] != '-' || s[13] != '-' || s[18] != '-' || s[23] != '-' {
+		return g, errors.New("GUID must be in XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX format")
+	}
+	var be [16]byte // Big-endian representation, same order as the string.
+	_, err = hex.Decode(be[0:4], []byte(s[0:8]))
+	if err == nil {
+		_, err = hex.Decode(be[4:6], []byte(s[9:13]))
+	}
+	if err == nil {
+		_, err = hex.Decode(be[6:8], []byte(s[14:18]))
+	}
+	if err == nil {
+		_, err = hex.Decode(be[8:10], []byte(s[19:23]))
+	}
+	if err == nil {
+		_, err = hex.Decode(be[10:16], []byte(s[24:36]))
+	}
+	if err != nil {
+		return g, fmt.Errorf("parsing GUID: %w", err)
+	}
+	binary.LittleEndian.PutUint32(g[0:4], binary.BigEndian.Uint32(be[0:4]))
+	binary.LittleEndian.PutUint16(g[4:6], binary.BigEndian.Uint16(be[4:6]))
+	binary.LittleEndian.PutUint16(g[6:8], binary.BigEndian.Uint16(be[6:8]))
+	copy(g[8:], be[8:])
+	return g, nil
+}
+
+// MustParseGUID is like [ParseGUID] but panics on error. Useful for initializing global variables.
+func MustParseGUID(s string) GUID {
+	g, err := ParseGUID(s)
+	if err != nil {
+		panic(err.Error())
+	}
+	return g
+}
+
+// IsZero returns true if all bytes of the GUID are zero. A zero partition type GUID marks an unused entry.
+func (g GUID) IsZero() bool {
+	return g == GUID{}
+}
+
+// String returns the canonical upper case XXXXXXXX-XXXX-XXXX-XXXX-XXXXXXXXXXXX representation of the GUID.
+func (g GUID) String() string {
+	return fmt.Sprintf("%08X-%04X-%04X-%04X-%012X",
+		binary.LittleEndian.Uint32(g[0:4]),
+		binary.LittleEndian.Uint16(g[4:6]),
+		binary.LittleEndian.Uint16(g[6:8]),
+		binary.BigEndian.Uint16(g[8:10]),
+		g[10:16],
+	)
+}
+
+// NewRandomGUID returns a random (version 4, variant 1) GUID read from rand, usually [crypto/rand.Reader].
+func NewRandomGUID(rand io.Reader) (g GUID, err error) {
+	_, err = io.ReadFull(rand, g[:])
+	if err != nil {
+		return g, err
+	}
+	g[7] = g[7]&0x0f | 0x40 // Version 4 in high nibble of little-endian third field.
+	g[8] = g[8]&0x3f | 0x80 // Variant 1.
+	return g, nil
+}
@@ -0,0 +1,130 @@
+package gpt
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/soypat/tinyboot/boot/mbr"
+)
+
+// HybridPartition selects a GPT partition to be mapped into a hybrid MBR.
+type HybridPartition struct {
+	// Index of the partition in the GPT partition entry array.
+	Index int
+	// Type is the MBR partition type of the mapped partition.
+	Type mbr.PartitionType
+	// Bootable sets the MBR active flag. Only one partition may be bootable.
+	Bootable bool
+}
+
+// MakeHybridMBR sets the partition table of bs to a hybrid MBR. Entry 0 is the GPT protective
+// entry covering LBA 1 up to the first GPT partition and is followed by up to three mapped
+// GPT partitions in the order given. Mapped partitions must lie within the first 2^32 sectors.
+func MakeHybridMBR(bs mbr.BootSector, entries []PartitionEntry, hybrid []HybridPartition) error {
+	if len(hybrid) == 0 || len(hybrid) > 3 {
+		return fmt.Errorf("hybrid MBR maps 1 to 3 partitions, got %d", len(hybrid))
+	}
+	var ptes [3]mbr.PartitionTableEntry
+	firstStart := int64(math.MaxUint32)
+	bootable := 0
+	for i, h := range hybrid {
+		if h.Index < 0 || h.Index >= len(entries) || !entries[h.Index].IsUsed() {
+			return fmt.Errorf("hybrid partition %d: GPT entry %d not in use", i, h.Index)
+		} else if h.Type == mbr.PartitionTypeUnused || h.Type == mbr.PartitionTypeGPTProtective {
+			return fmt.Errorf("hybrid partition %d: invalid MBR type %#x", i, h.Type)
+		}
+		p := entries[h.Index]
+		start, end := p.FirstLBA(), p.LastLBA()+1
+		if start < 2 || end <= start || end > math.MaxUint32 {
+			return fmt.Errorf("hybrid partition %d: LBAs %d..%d not representable in MBR", i, start, end-1)
+		}
+		var attrs mbr.DriveAttributes
+		if h.Bootable {
+			attrs = mbr.DriveAttrsBootable
+			bootable++
+		}
+		ptes[i] = mbr.MakePartitionTableEntryLBA(attrs, h.Type, uint32(start), uint32(end-start))
+	}
+	for _, p := range entries {
+		if p.IsUsed() && p.FirstLBA() < firstStart {
+			firstStart = p.FirstLBA()
+		}
+	}
+	if bootable > 1 {
+		return errors.New("more than one bootable hybrid partition")
+	}
+	bs.SetPartitionTable(0, mbr.MakePartitionTableEntryLBA(0, mbr.PartitionTypeGPTProtective, 1, uint32(firstStart-1)))
+	for i := range ptes {
+		bs.SetPartitionTable(i+1, ptes[i])
+	}
+	bs.SetBootSignature(mbr.BootSignature)
+	return nil
+}
+
+// WriteHybridDisk is like [WriteDisk] but writes a hybrid MBR generated by [MakeHybridMBR] instead of a protective MBR.
+// diskID is written as the MBR unique disk identifier, which some operating systems use to identify the disk.
+func WriteHybridDisk(w io.WriterAt, cfg DiskConfig, diskID uint32, entries []PartitionEntry, hybrid []HybridPartition) error {
+	err := cfg.Validate()
+	if err != nil {
+		return err
+	}
+	sector := make([]byte, cfg.SectorSize)
+	bs, _ := mbr.ToBootSector(sector)
+	err = MakeHybridMBR(bs, entries, hybrid)
+	if err != nil {
+		return err
+	}
+	bs.SetUniqueDiskID(diskID)
+	err = WriteTables(w, cfg, entries)
+	if err != nil {
+		return err
+	}
+	_, err = w.WriteAt(sector, 0)
+	if err != nil {
+		return fmt.Errorf("writing hybrid MBR: %w", err)
+	}
+	return nil
+}
+
+// ValidateHybridMBR checks a hybrid MBR agrees with the GPT partition entries: there must be exactly one
+// GPT protective entry which starts at LBA 1, covering the GPT header, and does not overlap any GPT partition.
+// Every other MBR entry must match the start and size of a GPT partition. All problems found are joined in
+// the returned error.
+func ValidateHybridMBR(bs mbr.BootSector, entries []PartitionEntry) (err error) {
+	protective := 0
+	for i := 0; i < 4; i++ {
+		pte := bs.PartitionTable(i)
+		start, num := int64(pte.StartLBA()), int64(pte.NumberOfLBA())
+		switch pte.PartitionType() {
+		case mbr.PartitionTypeUnused:
+			continue
+		case mbr.PartitionTypeGPTProtective:
+			protective++
+			if start != 1 {
+				err = errors.Join(err, fmt.Errorf("MBR protective entry %d starts at LBA %d, must start at LBA 1 to cover the GPT header", i, start))
+			}
+			for j, p := range entries {
+				if p.IsUsed() && start < p.LastLBA()+1 && start+num > p.FirstLBA() {
+					err = errors.Join(err, fmt.Errorf("MBR protective entry %d overlaps GPT partition %d", i, j))
+				}
+			}
+			continue
+		}
+		found := false
+		for _, p := range entries {
+			if p.IsUsed() && p.FirstLBA() == start && p.LastLBA()-p.FirstLBA()+1 == num {
+				found = true
+				break
+			}
+		}
+		if !found {
+			err = errors.Join(err, fmt.Errorf("MBR entry %d (LBA %d+%d) does not match any GPT partition", i, start, num))
+		}
+	}
+	if protective != 1 {
+		err = errors.Join(err, fmt.Errorf("hybrid MBR must have exactly one protective entry, got %d", protective))
+	}
+	return err
+}
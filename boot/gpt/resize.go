@@ -0,0 +1,103 @@
+package gpt
+
+import (
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// ReaderWriterAt is a disk that can be read and written at arbitrary offsets, such as an [*os.File].
+type ReaderWriterAt interface {
+	io.ReaderAt
+	io.WriterAt
+}
+
+// ResizeDisk moves the backup GPT header and partition entry array to the end of a disk of numSectors
+// sectors and updates the LastUsableLBA and BackupLBA fields of both headers, like "sgdisk -e". This is
+// needed after writing an image to a disk larger than the image. If growLast is set the partition with the
+// highest LBA is grown to the new last usable LBA, it is never truncated. A plain protective MBR is updated to span the new disk size,
+// hybrid MBRs are left untouched. The healthiest table as reported by [ReadDisk] is used as the source
+// so ResizeDisk also repairs a disk with one corrupt copy. Shrinking is allowed as long as all partitions fit.
+func ResizeDisk(rw ReaderWriterAt, sectorSize int, numSectors int64, growLast bool) error {
+	d, err := ReadDisk(rw, sectorSize)
+	if err != nil {
+		return err
+	}
+	src, _ := d.Healthy()
+	h := src.Header
+	ssz := int64(sectorSize)
+	arraySectors := (int64(len(src.entries)) + ssz - 1) / ssz
+	lastLBA := numSectors - 1
+	backupArrayLBA := lastLBA - arraySectors
+	lastUsable := backupArrayLBA - 1
+	// The backup header's entry LBA points to the old backup array, so the primary array goes
+	// at LBA 2 unless the primary header is valid.
+	primaryArrayLBA := int64(2)
+	if d.Primary.Err == nil {
+		primaryArrayLBA = h.PartitionEntryLBA()
+	}
+	if primaryArrayLBA+arraySectors > h.FirstUsableLBA() {
+		return fmt.Errorf("primary partition entry array at LBA %d overlaps first usable LBA %d", primaryArrayLBA, h.FirstUsableLBA())
+	} else if lastUsable < h.FirstUsableLBA() {
+		return fmt.Errorf("disk of %d sectors too small for GPT", numSectors)
+	}
+	last := -1
+	for i, p := range src.Entries {
+		if !p.IsUsed() {
+			continue
+		}
+		if last < 0 || p.LastLBA() > src.Entries[last].LastLBA() {
+			last = i
+		}
+	}
+	if last >= 0 && src.Entries[last].LastLBA() > lastUsable {
+		return fmt.Errorf("partition %d ends at LBA %d, past new last usable LBA %d", last, src.Entries[last].LastLBA(), lastUsable)
+	} else if growLast && last >= 0 {
+		src.Entries[last].SetLastLBA(lastUsable)
+	}
+	arrayCRC := crc32.ChecksumIEEE(src.entries)
+	primary := make([]byte, sectorSize)
+	backup := make([]byte, sectorSize)
+	for _, hdr := range []struct {
+		sector             []byte
+		current, alternate int64
+		entriesLBA         int64
+	}{
+		{sector: primary, current: 1, alternate: lastLBA, entriesLBA: primaryArrayLBA},
+		{sector: backup, current: lastLBA, alternate: 1, entriesLBA: backupArrayLBA},
+	} {
+		nh, _ := ToHeader(hdr.sector)
+		copy(nh.data, h.data)
+		nh.SetCurrentLBA(hdr.current)
+		nh.SetBackupLBA(hdr.alternate)
+		nh.SetPartitionEntryLBA(hdr.entriesLBA)
+		nh.SetLastUsableLBA(lastUsable)
+		nh.SetCRCOfPartitionEntries(arrayCRC)
+		nh.SetCRC(nh.ComputeCRC())
+	}
+	writes := []struct {
+		name string
+		lba  int64
+		data []byte
+	}{
+		{name: "backup partition entry array", lba: backupArrayLBA, data: src.entries},
+		{name: "backup header", lba: lastLBA, data: backup},
+		{name: "primary partition entry array", lba: primaryArrayLBA, data: src.entries},
+		{name: "primary header", lba: 1, data: primary},
+	}
+	for _, wr := range writes {
+		_, err = rw.WriteAt(wr.data, wr.lba*ssz)
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", wr.name, err)
+		}
+	}
+	if !d.ProtectiveMBR.IsGPTProtective() || d.ProtectiveMBR.IsHybrid() {
+		return nil // Leave hybrid or non-protective MBRs untouched.
+	}
+	d.ProtectiveMBR.SetPartitionTable(0, makeProtectiveEntry(numSectors))
+	_, err = rw.WriteAt(d.ProtectiveMBR.Bytes(), 0)
+	if err != nil {
+		return fmt.Errorf("writing protective MBR: %w", err)
+	}
+	return nil
+}
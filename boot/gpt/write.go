@@ -0,0 +1,185 @@
+package gpt
+
+import (
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+
+	"github.com/soypat/tinyboot/boot/mbr"
+)
+
+const (
+	// DefaultNumEntries is the number of partition entries written when none is specified.
+	DefaultNumEntries = 128
+	// minEntryArraySize is the minimum space the UEFI specification requires be reserved for the partition entry array.
+	minEntryArraySize = 16384
+)
+
+// DiskConfig describes the geometry of a GPT disk to be written by [WriteDisk].
+type DiskConfig struct {
+	// SectorSize is the logical block size of the disk in bytes, usually 512.
+	SectorSize int
+	// NumSectors is the size of the disk in sectors. The backup header is written to the last sector.
+	NumSectors int64
+	// DiskGUID uniquely identifies the disk.
+	DiskGUID GUID
+	// NumEntries is the number of entries in the partition entry array. If zero [DefaultNumEntries] is used.
+	NumEntries uint32
+}
+
+// Validate checks the configuration describes a disk large enough to hold both GPT copies.
+func (cfg DiskConfig) Validate() error {
+	if cfg.SectorSize < 512 || cfg.SectorSize&(cfg.SectorSize-1) != 0 {
+		return errBadSectorSize
+	}
+	if int64(cfg.numEntries())*PartitionEntrySize < minEntryArraySize {
+		return fmt.Errorf("partition entry array must be at least %d bytes", minEntryArraySize)
+	} else if int64(cfg.numEntries())*PartitionEntrySize > maxEntryArraySize {
+		return errors.New("partition entry array too large")
+	}
+	first, last := cfg.UsableLBAs()
+	if first > last {
+		return fmt.Errorf("disk of %d sectors too small to hold GPT", cfg.NumSectors)
+	}
+	return nil
+}
+
+// UsableLBAs returns the first and last (inclusive) LBA that may be used by partitions.
+func (cfg DiskConfig) UsableLBAs() (first, last int64) {
+	arraySectors := cfg.entryArraySectors()
+	return 2 + arraySectors, cfg.NumSectors - 2 - arraySectors
+}
+
+func (cfg DiskConfig) numEntries() uint32 {
+	if cfg.NumEntries == 0 {
+		return DefaultNumEntries
+	}
+	return cfg.NumEntries
+}
+
+func (cfg DiskConfig) entryArraySectors() int64 {
+	arraySize := int64(cfg.numEntries()) * PartitionEntrySize
+	return (arraySize + int64(cfg.SectorSize) - 1) / int64(cfg.SectorSize)
+}
+
+// WriteDisk writes a protective MBR at LBA 0, the primary GPT header at LBA 1 followed by its partition
+// entry array and the backup partition entry array followed by the backup GPT header at the last LBA of the disk.
+// Entries with a zero partition type GUID are written as unused. The MBR bootstrap code is zeroed.
+func WriteDisk(w io.WriterAt, cfg DiskConfig, entries []PartitionEntry) error {
+	err := cfg.Validate()
+	if err != nil {
+		return err
+	}
+	pmbr := make([]byte, cfg.SectorSize)
+	bs, _ := mbr.ToBootSector(pmbr)
+	bs.SetPartitionTable(0, makeProtectiveEntry(cfg.NumSectors))
+	bs.SetBootSignature(mbr.BootSignature)
+	_, err = w.WriteAt(pmbr, 0)
+	if err != nil {
+		return fmt.Errorf("writing protective MBR: %w", err)
+	}
+	return WriteTables(w, cfg, entries)
+}
+
+// WriteTables writes the primary and backup GPT headers and partition entry arrays, leaving LBA 0 untouched.
+// Use it instead of [WriteDisk] when a custom MBR, such as a hybrid MBR, is written separately.
+func WriteTables(w io.WriterAt, cfg DiskConfig, entries []PartitionEntry) error {
+	err := cfg.Validate()
+	if err != nil {
+		return err
+	}
+	array, err := cfg.makeEntryArray(entries)
+	if err != nil {
+		return err
+	}
+	sectorSize := int64(cfg.SectorSize)
+	lastLBA := cfg.NumSectors - 1
+	backupArrayLBA := lastLBA - cfg.entryArraySectors()
+	arrayCRC := crc32.ChecksumIEEE(array)
+	primary := cfg.makeHeaderSector(1, lastLBA, 2, arrayCRC)
+	backup := cfg.makeHeaderSector(lastLBA, 1, backupArrayLBA, arrayCRC)
+	writes := []struct {
+		name string
+		lba  int64
+		data []byte
+	}{
+		{name: "primary partition entry array", lba: 2, data: array},
+		{name: "primary header", lba: 1, data: primary},
+		{name: "backup partition entry array", lba: backupArrayLBA, data: array},
+		{name: "backup header", lba: lastLBA, data: backup},
+	}
+	for _, wr := range writes {
+		_, err = w.WriteAt(wr.data, wr.lba*sectorSize)
+		if err != nil {
+			return fmt.Errorf("writing %s: %w", wr.name, err)
+		}
+	}
+	return nil
+}
+
+// makeEntryArray validates the entries and returns the partition entry array.
+func (cfg DiskConfig) makeEntryArray(entries []PartitionEntry) ([]byte, error) {
+	if len(entries) > int(cfg.numEntries()) {
+		return nil, fmt.Errorf("%d partition entries exceed entry array length %d", len(entries), cfg.numEntries())
+	}
+	first, last := cfg.UsableLBAs()
+	for i, p := range entries {
+		if !p.IsUsed() {
+			continue
+		}
+		pfirst, plast := p.FirstLBA(), p.LastLBA()
+		if pfirst > plast {
+			return nil, fmt.Errorf("partition %d first LBA %d after last LBA %d", i, pfirst, plast)
+		} else if pfirst < first || plast > last {
+			return nil, fmt.Errorf("partition %d LBAs %d..%d outside usable range %d..%d", i, pfirst, plast, first, last)
+		}
+		for j := 0; j < i; j++ {
+			if entries[j].IsUsed() && pfirst <= entries[j].LastLBA() && plast >= entries[j].FirstLBA() {
+				return nil, fmt.Errorf("partition %d overlaps partition %d", i, j)
+			}
+		}
+	}
+	array := make([]byte, int(cfg.numEntries())*PartitionEntrySize)
+	for i, p := range entries {
+		copy(array[i*PartitionEntrySize:], p.data)
+	}
+	return array, nil
+}
+
+// makeHeaderSector returns a sector containing a GPT header with its CRC computed.
+func (cfg DiskConfig) makeHeaderSector(currentLBA, backupLBA, entriesLBA int64, entriesCRC uint32) []byte {
+	sector := make([]byte, cfg.SectorSize)
+	h, _ := ToHeader(sector)
+	first, last := cfg.UsableLBAs()
+	h.SetSignature(Signature)
+	h.SetRevision(Revision1)
+	h.SetSize(HeaderSize)
+	h.SetCurrentLBA(currentLBA)
+	h.SetBackupLBA(backupLBA)
+	h.SetFirstUsableLBA(first)
+	h.SetLastUsableLBA(last)
+	h.SetDiskGUID(cfg.DiskGUID)
+	h.SetPartitionEntryLBA(entriesLBA)
+	h.SetNumberOfPartitionEntries(cfg.numEntries())
+	h.SetSizeOfPartitionEntry(PartitionEntrySize)
+	h.SetCRCOfPartitionEntries(entriesCRC)
+	h.SetCRC(h.ComputeCRC())
+	return sector
+}
+
+// makeProtectiveEntry returns the MBR partition table entry covering the whole GPT disk as
+// specified by UEFI: starting at LBA 1 and spanning the rest of the disk, saturated to 32 bits.
+func makeProtectiveEntry(numSectors int64) mbr.PartitionTableEntry {
+	size := numSectors - 1
+	if size > math.MaxUint32 {
+		size = math.MaxUint32
+	}
+	startCHS := mbr.LBAToCHS(1, mbr.DefaultGeometry)
+	lastCHS := mbr.LBAToCHS(uint32(size), mbr.DefaultGeometry)
+	if lastCHS.IsSaturated() {
+		lastCHS = mbr.NewCHS(1023, 255, 63) // UEFI requires 0xFFFFFF when not representable.
+	}
+	return mbr.MakePartitionTableEntry(0, mbr.PartitionTypeGPTProtective, 1, uint32(size), startCHS, lastCHS)
+}
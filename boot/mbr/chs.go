@@ -0,0 +1,84 @@
+package mbr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// CHS is a cylinder-head-sector address as stored in the 3 bytes of a partition table entry.
+// This addressing scheme is deprecated by modern operating systems in favor of LBA, or Logical Block Addressing.
+//
+// The first byte holds the head, the low 6 bits of the second byte hold the sector (1..63) and
+// its high 2 bits hold bits 8..9 of the cylinder, whose low 8 bits are stored in the third byte.
+type CHS uint32
+
+const (
+	maxCylinder = 1023
+	maxSector   = 63
+)
+
+// Geometry describes the number of heads per cylinder and sectors per track used to convert between CHS and LBA.
+type Geometry struct {
+	Heads           uint32 // Number of heads per cylinder, at most 255.
+	SectorsPerTrack uint32 // Number of sectors per track, at most 63.
+}
+
+// DefaultGeometry is the 255 head, 63 sector geometry used by modern partitioning tools and BIOSes using LBA translation.
+var DefaultGeometry = Geometry{Heads: 255, SectorsPerTrack: 63}
+
+// NewCHS creates a new CHS address from the cylinder (0..1023), head (0..255) and sector (1..63) numbers. See "CHS addressing".
+func NewCHS(cylinder uint16, head, sector uint8) CHS {
+	return CHS(head) | CHS(sector&0x3f|uint8(cylinder>>8)<<6)<<8 | CHS(uint8(cylinder))<<16
+}
+
+// Tuple returns the cylinder, head and sector numbers of the CHS address.
+func (chs CHS) Tuple() (cylinder uint16, head, sector uint8) {
+	head = uint8(chs)
+	sector = uint8(chs>>8) & 0x3f
+	cylinder = uint16(uint8(chs>>16)) | uint16(uint8(chs>>8)>>6)<<8
+	return cylinder, head, sector
+}
+
+// LBAToCHS converts a logical block address to a CHS address using the geometry. Addresses that do not fit
+// in CHS are saturated to cylinder 1023, the last head and the last sector, i.e. 1023/254/63 for [DefaultGeometry].
+// A zero Geometry is taken to be [DefaultGeometry].
+func LBAToCHS(lba uint32, g Geometry) CHS {
+	g = g.orDefault()
+	sector := lba%g.SectorsPerTrack + 1
+	track := lba / g.SectorsPerTrack
+	head := track % g.Heads
+	cylinder := track / g.Heads
+	if cylinder > maxCylinder {
+		return NewCHS(maxCylinder, uint8(g.Heads-1), uint8(g.SectorsPerTrack))
+	}
+	return NewCHS(uint16(cylinder), uint8(head), uint8(sector))
+}
+
+// ToLBA converts the CHS address to a logical block address using the geometry. It returns an error if the
+// address is not valid for the geometry. A zero Geometry is taken to be [DefaultGeometry].
+func (chs CHS) ToLBA(g Geometry) (uint32, error) {
+	g = g.orDefault()
+	cylinder, head, sector := chs.Tuple()
+	if sector == 0 {
+		return 0, errors.New("CHS sector number starts at 1")
+	} else if uint32(sector) > g.SectorsPerTrack {
+		return 0, fmt.Errorf("CHS sector %d exceeds %d sectors per track", sector, g.SectorsPerTrack)
+	} else if uint32(head) >= g.Heads {
+		return 0, fmt.Errorf("CHS head %d exceeds %d heads", head, g.Heads)
+	}
+	return (uint32(cylinder)*g.Heads+uint32(head))*g.SectorsPerTrack + uint32(sector) - 1, nil
+}
+
+// IsSaturated returns true if the CHS address is at the maximum cylinder, which signals the
+// address could not be represented in CHS and the LBA fields should be used instead.
+func (chs CHS) IsSaturated() bool {
+	cylinder, _, _ := chs.Tuple()
+	return cylinder == maxCylinder
+}
+
+func (g Geometry) orDefault() Geometry {
+	if g.Heads == 0 || g.SectorsPerTrack == 0 {
+		return DefaultGeometry
+	}
+	return g
+}
@@ -0,0 +1,211 @@
+package mbr
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxLogicalPartitions limits the length of an EBR chain to guard against corrupt chains.
+const maxLogicalPartitions = 1024
+
+// IsExtended returns true if the partition type marks an extended partition containing a chain of
+// Extended Boot Records (EBR) that describe logical partitions.
+func (pt PartitionType) IsExtended() bool {
+	return pt == PartitionTypeExtended || pt == PartitionTypeExtendedLBA || pt == PartitionTypeLinuxExtended
+}
+
+// LogicalPartition is a partition described by an Extended Boot Record (EBR) inside an extended partition.
+type LogicalPartition struct {
+	// EBRLBA is the absolute LBA of the EBR describing this partition.
+	EBRLBA uint32
+	// Entry is the partition table entry as stored in the EBR. Its StartLBA is relative to EBRLBA.
+	Entry PartitionTableEntry
+}
+
+// StartLBA returns the absolute starting LBA of the logical partition.
+func (lp LogicalPartition) StartLBA() uint32 {
+	return lp.EBRLBA + lp.Entry.StartLBA()
+}
+
+// NumberOfLBA returns the number of sectors in the logical partition.
+func (lp LogicalPartition) NumberOfLBA() uint32 {
+	return lp.Entry.NumberOfLBA()
+}
+
+// LogicalIterator iterates over the logical partitions of an extended partition by following the EBR chain.
+// Use it like a [bufio.Scanner]:
+//
+//	it := bs.LogicalPartitions(r, 512)
+//	for it.Next() {
+//		lp := it.Partition()
+//	}
+//	if it.Err() != nil { ... }
+type LogicalIterator struct {
+	r          io.ReaderAt
+	sectorSize int64
+	extStart   uint32 // Absolute LBA of extended partition start, which is the first EBR.
+	next       uint32 // Absolute LBA of next EBR to read, 0 when done.
+	count      int
+	lp         LogicalPartition
+	err        error
+	buf        [512]byte
+}
+
+// LogicalPartitions returns an iterator over the logical partitions in the first extended
+// partition of the MBR. If there is no extended partition the iterator yields no partitions.
+func (mbr *BootSector) LogicalPartitions(r io.ReaderAt, sectorSize int) *LogicalIterator {
+	it := &LogicalIterator{r: r, sectorSize: int64(sectorSize)}
+	if sectorSize < 512 {
+		it.err = errors.New("sector size must be at least 512")
+		return it
+	}
+	for i := 0; i < 4; i++ {
+		pte := mbr.PartitionTable(i)
+		if pte.PartitionType().IsExtended() {
+			it.extStart = pte.StartLBA()
+			it.next = it.extStart
+			break
+		}
+	}
+	return it
+}
+
+// Next advances the iterator to the next logical partition. It returns false when the end of
+// the chain is reached or on error, which can be checked with [LogicalIterator.Err].
+func (it *LogicalIterator) Next() bool {
+	for it.err == nil && it.next != 0 {
+		if it.count >= maxLogicalPartitions {
+			it.err = errors.New("EBR chain too long")
+			return false
+		}
+		it.count++
+		ebrLBA := it.next
+		_, err := it.r.ReadAt(it.buf[:], int64(ebrLBA)*it.sectorSize)
+		if err != nil {
+			it.err = fmt.Errorf("reading EBR at LBA %d: %w", ebrLBA, err)
+			return false
+		}
+		ebr, _ := ToBootSector(it.buf[:])
+		if ebr.BootSignature() != BootSignature {
+			it.err = fmt.Errorf("EBR at LBA %d missing boot signature", ebrLBA)
+			return false
+		}
+		entry := ebr.PartitionTable(0)
+		link := ebr.PartitionTable(1)
+		it.next = 0
+		if link.PartitionType().IsExtended() && link.StartLBA() != 0 {
+			it.next = it.extStart + link.StartLBA()
+			if it.next <= ebrLBA {
+				// Chains must progress forward, this also guarantees no loops.
+				it.err = fmt.Errorf("EBR at LBA %d links backwards to LBA %d", ebrLBA, it.next)
+				return false
+			}
+		}
+		if entry.PartitionType() == PartitionTypeUnused {
+			continue // Empty EBR, may happen at the start of an empty extended partition.
+		}
+		it.lp = LogicalPartition{EBRLBA: ebrLBA, Entry: entry}
+		return true
+	}
+	return false
+}
+
+// Partition returns the logical partition found by the last call to [LogicalIterator.Next].
+func (it *LogicalIterator) Partition() LogicalPartition {
+	return it.lp
+}
+
+// Err returns the first error encountered while following the EBR chain.
+func (it *LogicalIterator) Err() error {
+	return it.err
+}
+
+// ExtendedBootRecord is an EBR sector to be written at an absolute LBA.
+type ExtendedBootRecord struct {
+	LBA  uint32
+	Data [512]byte
+}
+
+// MakeEBRChain builds the chain of Extended Boot Records describing the logical partitions. Logical partition
+// entries have absolute StartLBAs and must be sorted and not overlap. Each partition's EBR is placed at the
+// sector immediately preceding it, so partitions must be preceded by at least one unused sector. The returned
+// extended partition entry spans from the first EBR to the end of the last logical partition and
+// should be written to the primary partition table.
+func MakeEBRChain(logical []PartitionTableEntry) (extended PartitionTableEntry, ebrs []ExtendedBootRecord, err error) {
+	if len(logical) == 0 {
+		return extended, nil, errors.New("no logical partitions")
+	}
+	ebrs = make([]ExtendedBootRecord, len(logical))
+	var prevEnd uint32
+	for i := range logical {
+		start := logical[i].StartLBA()
+		if start < 2 || start-1 < prevEnd {
+			return extended, nil, fmt.Errorf("logical partition %d at LBA %d has no free sector for its EBR", i, start)
+		} else if logical[i].NumberOfLBA() == 0 {
+			return extended, nil, fmt.Errorf("logical partition %d is empty", i)
+		}
+		ebrs[i].LBA = start - 1
+		prevEnd = start + logical[i].NumberOfLBA()
+		if prevEnd < start {
+			return extended, nil, fmt.Errorf("logical partition %d overflows 32 bit LBA", i)
+		}
+	}
+	extStart := ebrs[0].LBA
+	for i := range logical {
+		ebr, _ := ToBootSector(ebrs[i].Data[:])
+		entry := logical[i]
+		binary.LittleEndian.PutUint32(entry.data[8:12], 1) // Relative to EBR.
+		ebr.SetPartitionTable(0, entry)
+		if i+1 < len(logical) {
+			next := logical[i+1]
+			nextEBR := ebrs[i+1].LBA
+			size := next.StartLBA() + next.NumberOfLBA() - nextEBR
+			// Link entry LBA is relative to the extended partition start, CHS fields are absolute.
+			startCHS, lastCHS := LBAToCHS(nextEBR, DefaultGeometry), LBAToCHS(nextEBR+size-1, DefaultGeometry)
+			ebr.SetPartitionTable(1, MakePartitionTableEntry(0, PartitionTypeExtended, nextEBR-extStart, size, startCHS, lastCHS))
+		}
+		ebr.SetBootSignature(BootSignature)
+	}
+	extended = MakePartitionTableEntryLBA(0, PartitionTypeExtended, extStart, prevEnd-extStart)
+	return extended, ebrs, nil
+}
+
+// WritePartitions sets the partition table of the boot sector and writes it to LBA 0 of w. If more than four
+// partitions are given the first three are written as primary partitions and the rest as logical partitions
+// inside an extended partition occupying the fourth entry, see [MakeEBRChain] for logical partition requirements.
+func WritePartitions(w io.WriterAt, sectorSize int, mbr BootSector, parts []PartitionTableEntry) error {
+	if sectorSize < 512 {
+		return errors.New("sector size must be at least 512")
+	}
+	var ebrs []ExtendedBootRecord
+	primary := parts
+	if len(parts) > 4 {
+		extended, chain, err := MakeEBRChain(parts[3:])
+		if err != nil {
+			return err
+		}
+		ebrs = chain
+		primary = append(parts[:3:3], extended)
+	}
+	for i := 0; i < 4; i++ {
+		var pte PartitionTableEntry
+		if i < len(primary) {
+			pte = primary[i]
+		}
+		mbr.SetPartitionTable(i, pte)
+	}
+	mbr.SetBootSignature(BootSignature)
+	_, err := w.WriteAt(mbr.data, 0)
+	if err != nil {
+		return err
+	}
+	for i := range ebrs {
+		_, err = w.WriteAt(ebrs[i].Data[:], int64(ebrs[i].LBA)*int64(sectorSize))
+		if err != nil {
+			return fmt.Errorf("writing EBR %d: %w", i, err)
+		}
+	}
+	return nil
+}
@@ -6,6 +6,8 @@ package mbr
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"math"
 )
 
 const (
@@ -49,21 +51,120 @@ func (mbr *BootSector) Bootstrap() []byte {
 	return mbr.data[0:bootstrapLen]
 }
 
+// Bytes returns the 512 bytes of the MBR. Modifying the returned slice modifies the MBR.
+func (mbr *BootSector) Bytes() []byte {
+	return mbr.data
+}
+
 func (mbr *BootSector) UniqueDiskID() uint32 {
 	return binary.LittleEndian.Uint32(mbr.data[uniqueDiskIDOff : uniqueDiskIDOff+uniqueDiskIDLen])
 }
 
+// SetUniqueDiskID sets the optional 32-bit disk signature used by operating systems to identify the disk.
+func (mbr *BootSector) SetUniqueDiskID(id uint32) {
+	binary.LittleEndian.PutUint32(mbr.data[uniqueDiskIDOff:uniqueDiskIDOff+uniqueDiskIDLen], id)
+}
+
 // BootSignature returns the boot signature of the MBR. This is a magic number (0xAA55) that indicates that this is a valid MBR.
 func (mbr *BootSector) BootSignature() uint16 {
 	return binary.LittleEndian.Uint16(mbr.data[bootSignatureOff : bootSignatureOff+2])
 }
 
+// SetBootSignature sets the boot signature of the MBR. Use [BootSignature] to mark the MBR as valid.
+func (mbr *BootSector) SetBootSignature(sig uint16) {
+	binary.LittleEndian.PutUint16(mbr.data[bootSignatureOff:bootSignatureOff+2], sig)
+}
+
+// Validate checks the MBR for a valid boot signature, at most one active partition, partitions
+// that overlap or extend past the end of a disk of diskSectors sectors and CHS fields inconsistent
+// with the LBA fields assuming the standard 255 head, 63 sector geometry. If diskSectors is zero the
+// disk size check is skipped. All problems found are joined in the returned error.
+func (mbr *BootSector) Validate(diskSectors uint32) (err error) {
+	if sig := mbr.BootSignature(); sig != BootSignature {
+		err = errors.Join(err, fmt.Errorf("invalid boot signature %#x", sig))
+	}
+	active := 0
+	for i := 0; i < 4; i++ {
+		pte := mbr.PartitionTable(i)
+		if pte.PartitionType() == PartitionTypeUnused {
+			continue
+		}
+		attrs := pte.Attributes()
+		if attrs.IsBootable() {
+			active++
+		}
+		if attrs&^DriveAttrsBootable != 0 {
+			err = errors.Join(err, fmt.Errorf("partition %d: invalid status byte %#x", i, uint8(attrs)))
+		}
+		start, num := pte.StartLBA(), pte.NumberOfLBA()
+		end := uint64(start) + uint64(num) // Exclusive.
+		saturatedProtective := pte.PartitionType() == PartitionTypeGPTProtective && num == math.MaxUint32
+		if num == 0 {
+			err = errors.Join(err, fmt.Errorf("partition %d: zero size", i))
+		} else if start == 0 {
+			err = errors.Join(err, fmt.Errorf("partition %d: starts at LBA 0 which holds the MBR", i))
+		} else if diskSectors != 0 && end > uint64(diskSectors) && !saturatedProtective {
+			err = errors.Join(err, fmt.Errorf("partition %d: LBAs %d..%d past end of disk with %d sectors", i, start, end-1, diskSectors))
+		}
+		for j := 0; j < i; j++ {
+			other := mbr.PartitionTable(j)
+			if other.PartitionType() == PartitionTypeUnused {
+				continue
+			}
+			otherEnd := uint64(other.StartLBA()) + uint64(other.NumberOfLBA())
+			if uint64(start) < otherEnd && end > uint64(other.StartLBA()) {
+				err = errors.Join(err, fmt.Errorf("partition %d overlaps partition %d", i, j))
+			}
+		}
+		if num == 0 {
+			continue
+		}
+		chsChecks := [2]struct {
+			name string
+			chs  CHS
+			lba  uint64
+		}{{"start", pte.CHSStart(), uint64(start)}, {"last", pte.CHSLast(), end - 1}}
+		for _, c := range chsChecks {
+			if c.chs == 0 || c.chs.IsSaturated() {
+				continue // CHS unset or not representable, LBA is used.
+			}
+			lba, chsErr := c.chs.ToLBA(DefaultGeometry)
+			if chsErr != nil {
+				err = errors.Join(err, fmt.Errorf("partition %d: %s CHS: %w", i, c.name, chsErr))
+			} else if uint64(lba) != c.lba {
+				err = errors.Join(err, fmt.Errorf("partition %d: %s CHS maps to LBA %d, expected %d", i, c.name, lba, c.lba))
+			}
+		}
+	}
+	if active > 1 {
+		err = errors.Join(err, fmt.Errorf("%d active partitions, at most one allowed", active))
+	}
+	return err
+}
+
 // IsProtectiveMBR returns true if the first partition of the MBR is a GPT protective MBR.
 // In this case the MBR is not used for booting and the GUID Partition Table can be found in the next LBA.
 func (mbr *BootSector) IsGPTProtective() bool {
 	return PartitionType(mbr.data[pteOffset+4]) == PartitionTypeGPTProtective
 }
 
+// IsHybrid returns true if the MBR is a hybrid MBR: it contains a GPT protective entry in any of the
+// four partition table entries alongside at least one other partition that maps a GPT partition.
+// Hybrid MBRs let legacy firmware, such as Raspberry Pi boot ROMs, boot from a GPT disk.
+func (mbr *BootSector) IsHybrid() bool {
+	protective, others := 0, 0
+	for i := 0; i < 4; i++ {
+		switch PartitionType(mbr.data[pteOffset+i*pteLen+4]) {
+		case PartitionTypeGPTProtective:
+			protective++
+		case PartitionTypeUnused:
+		default:
+			others++
+		}
+	}
+	return protective == 1 && others > 0
+}
+
 // PartitionTable returns the idx'th partition table entry of the MBR.
 func (mbr *BootSector) PartitionTable(idx int) PartitionTableEntry {
 	if idx > 3 {
@@ -89,11 +190,21 @@ func MakePartitionTableEntry(attrs DriveAttributes, Type PartitionType, startLBA
 	pte.data[4] = byte(Type)
 	binary.LittleEndian.PutUint32(pte.data[8:12], startLBA)
 	binary.LittleEndian.PutUint32(pte.data[12:16], numLBA)
-	pte.data[1], pte.data[2], pte.data[3] = startCHS.Tuple()
-	pte.data[5], pte.data[6], pte.data[7] = lastCHS.Tuple()
+	pte.data[1], pte.data[2], pte.data[3] = byte(startCHS), byte(startCHS>>8), byte(startCHS>>16)
+	pte.data[5], pte.data[6], pte.data[7] = byte(lastCHS), byte(lastCHS>>8), byte(lastCHS>>16)
 	return pte
 }
 
+// MakePartitionTableEntryLBA creates a new partition table entry whose CHS fields are computed from
+// the LBA fields using [DefaultGeometry].
+func MakePartitionTableEntryLBA(attrs DriveAttributes, Type PartitionType, startLBA, numLBA uint32) PartitionTableEntry {
+	var lastCHS CHS
+	if numLBA != 0 {
+		lastCHS = LBAToCHS(startLBA+numLBA-1, DefaultGeometry)
+	}
+	return MakePartitionTableEntry(attrs, Type, startLBA, numLBA, LBAToCHS(startLBA, DefaultGeometry), lastCHS)
+}
+
 // Attributes returns the attributes of the partition the PTE refers to.
 func (pte *PartitionTableEntry) Attributes() DriveAttributes {
 	return DriveAttributes(pte.data[0])
@@ -130,33 +241,22 @@ func (attrs DriveAttributes) IsBootable() bool {
 	return DriveAttrsBootable&attrs != 0
 }
 
-// CHS is a cylinder-head-sector address. This addressing scheme is deprecated by modern operating systems
-// in favor of LBA, or Logical Block Addressing.
-type CHS uint32
-
-func (chs CHS) Tuple() (cylinder, head, sector uint8) {
-	return uint8(chs), uint8(chs >> 8), uint8(chs >> 16)
-}
-
-// NewCHS creates a new CHS address from the cylinder, head and sector numbers. See "CHS addressing".
-func NewCHS(cylinder, head, sector uint8) CHS {
-	return CHS(cylinder) | CHS(head)<<8 | CHS(sector)<<16
-}
-
 // PartitionType refers to the type of partition the Partition Table Entry refers to.
 type PartitionType byte
 
 const (
-	PartitionTypeUnused   PartitionType = 0x00
-	PartitionTypeFAT12    PartitionType = 0x01
-	PartitionTypeFAT16    PartitionType = 0x04
-	PartitionTypeExtended PartitionType = 0x05
-	PartitionTypeFAT32CHS PartitionType = 0x0B
-	PartitionTypeFAT32LBA PartitionType = 0x0C
-	PartitionTypeNTFS     PartitionType = 0x07 // Also includes exFAT.
-	PartitionTypeLinux    PartitionType = 0x83
-	PartitionTypeFreeBSD  PartitionType = 0xA5
-	PartitionTypeAppleHFS PartitionType = 0xAF
+	PartitionTypeUnused        PartitionType = 0x00
+	PartitionTypeFAT12         PartitionType = 0x01
+	PartitionTypeFAT16         PartitionType = 0x04
+	PartitionTypeExtended      PartitionType = 0x05
+	PartitionTypeFAT32CHS      PartitionType = 0x0B
+	PartitionTypeFAT32LBA      PartitionType = 0x0C
+	PartitionTypeExtendedLBA   PartitionType = 0x0F // Extended partition using LBA addressing.
+	PartitionTypeNTFS          PartitionType = 0x07 // Also includes exFAT.
+	PartitionTypeLinux         PartitionType = 0x83
+	PartitionTypeLinuxExtended PartitionType = 0x85
+	PartitionTypeFreeBSD       PartitionType = 0xA5
+	PartitionTypeAppleHFS      PartitionType = 0xAF
 
 	PartitionTypeGPTProtective PartitionType = 0xEE
 )
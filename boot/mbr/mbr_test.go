@@ -0,0 +1,133 @@
+package mbr
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSectorSize = 512
+
+func TestLogicalPartitions(t *testing.T) {
+	const numSectors = 8192
+	fp := makeTestFile(t, numSectors)
+	var parts []PartitionTableEntry
+	for i := uint32(0); i < 7; i++ {
+		parts = append(parts, MakePartitionTableEntry(0, PartitionTypeLinux, 1024+i*1024, 512, 0, 0))
+	}
+	bs, _ := ToBootSector(make([]byte, 512))
+	err := WritePartitions(fp, testSectorSize, bs, parts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make([]byte, 512)
+	_, err = fp.ReadAt(got, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ = ToBootSector(got)
+	ext := bs.PartitionTable(3)
+	if !ext.PartitionType().IsExtended() {
+		t.Fatalf("expected extended partition in 4th entry, got type %#x", ext.PartitionType())
+	} else if ext.StartLBA() != parts[3].StartLBA()-1 {
+		t.Errorf("expected extended partition to start at first EBR, got %d", ext.StartLBA())
+	}
+	it := bs.LogicalPartitions(fp, testSectorSize)
+	i := 3
+	for it.Next() {
+		lp := it.Partition()
+		if lp.StartLBA() != parts[i].StartLBA() || lp.NumberOfLBA() != parts[i].NumberOfLBA() {
+			t.Errorf("logical partition %d: expected LBA %d+%d, got %d+%d", i, parts[i].StartLBA(), parts[i].NumberOfLBA(), lp.StartLBA(), lp.NumberOfLBA())
+		}
+		i++
+	}
+	if it.Err() != nil {
+		t.Fatal(it.Err())
+	} else if i != len(parts) {
+		t.Errorf("expected %d logical partitions, got %d", len(parts)-3, i-3)
+	}
+
+	// Logical partitions need a free sector before them for their EBR.
+	parts[4] = MakePartitionTableEntry(0, PartitionTypeLinux, parts[3].StartLBA()+parts[3].NumberOfLBA(), 512, 0, 0)
+	_, _, err = MakeEBRChain(parts[3:])
+	if err == nil {
+		t.Error("expected error for logical partition with no room for EBR")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	bs, _ := ToBootSector(make([]byte, 512))
+	bs.SetBootSignature(BootSignature)
+	// CHS of LBA 2048 is cylinder 0, head 32, sector 33.
+	bs.SetPartitionTable(0, MakePartitionTableEntry(DriveAttrsBootable, PartitionTypeFAT32LBA, 2048, 2048, NewCHS(0, 32, 33), 0))
+	bs.SetPartitionTable(1, MakePartitionTableEntry(0, PartitionTypeLinux, 4096, 4096, 0, 0))
+	err := bs.Validate(8192)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs.SetPartitionTable(2, MakePartitionTableEntry(DriveAttrsBootable, PartitionTypeLinux, 6000, 4096, NewCHS(0, 1, 1), 0))
+	bs.SetBootSignature(0)
+	err = bs.Validate(8192)
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	wantErrs := []string{"boot signature", "active partitions", "overlaps partition 1", "past end of disk", "start CHS"}
+	for _, want := range wantErrs {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected error containing %q, got:\n%s", want, err)
+		}
+	}
+}
+
+func TestCHS(t *testing.T) {
+	tests := []struct {
+		lba  uint32
+		c    uint16
+		h, s uint8
+	}{
+		{lba: 0, c: 0, h: 0, s: 1},
+		{lba: 1, c: 0, h: 0, s: 2},
+		{lba: 2048, c: 0, h: 32, s: 33},
+		{lba: 16064999, c: 999, h: 254, s: 63},
+		{lba: 16450559, c: 1023, h: 254, s: 63}, // Last representable.
+	}
+	for _, test := range tests {
+		chs := LBAToCHS(test.lba, DefaultGeometry)
+		c, h, s := chs.Tuple()
+		if c != test.c || h != test.h || s != test.s {
+			t.Errorf("LBA %d: expected CHS %d/%d/%d, got %d/%d/%d", test.lba, test.c, test.h, test.s, c, h, s)
+		}
+		lba, err := chs.ToLBA(DefaultGeometry)
+		if err != nil {
+			t.Error(err)
+		} else if lba != test.lba {
+			t.Errorf("CHS %d/%d/%d: expected LBA %d, got %d", c, h, s, test.lba, lba)
+		}
+	}
+	chs := LBAToCHS(1<<30, DefaultGeometry)
+	if !chs.IsSaturated() || chs != NewCHS(1023, 254, 63) {
+		t.Errorf("expected saturated CHS, got %#x", chs)
+	}
+	// Cylinder high bits are stored in the sector byte.
+	if chs := NewCHS(0x3ff, 0, 1); chs != 0xffc100 {
+		t.Errorf("expected bytes 0x00,0xc1,0xff got %#06x", uint32(chs))
+	}
+	_, err := NewCHS(0, 0, 0).ToLBA(DefaultGeometry)
+	if err == nil {
+		t.Error("expected error for sector 0")
+	}
+}
+
+func makeTestFile(t *testing.T, numSectors int64) *os.File {
+	fp, err := os.Create(filepath.Join(t.TempDir(), "mbr.img"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { fp.Close() })
+	err = fp.Truncate(numSectors * testSectorSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fp
+}
@@ -0,0 +1,177 @@
+package picobin
+
+import (
+	"errors"
+	"fmt"
+)
+
+// LoopBlock is a [Block] that is part of a [BlockLoop] along with its position in ROM.
+type LoopBlock struct {
+	Block
+	// Offset is the offset in bytes of the block's start marker relative to the start of ROM.
+	Offset int
+}
+
+// End returns the offset of the first byte after the block's end marker.
+func (lb LoopBlock) End() int { return lb.Offset + lb.Size() }
+
+// BlockLoop is a closed loop of blocks linked to one another as read by the bootrom.
+// The first block of the loop is the one found by the bootrom when scanning for a block start marker
+// and the last block links back to the first block.
+type BlockLoop struct {
+	// Blocks in loop order. Each block's Link points to the next block's Offset and the last block's Link points to the first block.
+	Blocks []LoopBlock
+}
+
+// DecodeBlockLoop decodes the block loop in rom whose first block starts at offset start by following block links until
+// a block links back to the first block. The blocks decoded until an error was encountered are returned along with the error.
+// Note that blocks' items are not validated after being decoded. Call [BlockLoop.Validate] to ensure loop saneness.
+func DecodeBlockLoop(rom []byte, start int) (BlockLoop, error) {
+	return decodeBlockLoop(start, func(off int) (Block, error) {
+		if off < 0 || off >= len(rom) {
+			return Block{}, errors.New("offset out of ROM")
+		}
+		block, _, err := DecodeBlock(rom[off:])
+		return block, err
+	})
+}
+
+// decodeBlockLoop decodes the block loop starting at offset start by following links of blocks decoded with decode.
+func decodeBlockLoop(start int, decode func(off int) (Block, error)) (BlockLoop, error) {
+	var loop BlockLoop
+	off := start
+	for {
+		block, err := decode(off)
+		if err != nil {
+			return loop, fmt.Errorf("decoding block %d at offset %#x: %w", len(loop.Blocks), off, err)
+		}
+		loop.Blocks = append(loop.Blocks, LoopBlock{Block: block, Offset: off})
+		next := off + block.Link
+		if next == start {
+			break // Loop closed.
+		}
+		for i := range loop.Blocks {
+			if loop.Blocks[i].Offset == next {
+				return loop, fmt.Errorf("block %d at offset %#x links to block %d which is not the first block", len(loop.Blocks)-1, off, i)
+			}
+		}
+		off = next
+	}
+	return loop, loop.validateLayout()
+}
+
+// Len returns the number of blocks in the loop.
+func (l BlockLoop) Len() int { return len(l.Blocks) }
+
+// Validate checks the loop is closed, block offsets are word aligned, blocks do not overlap and validates each block.
+func (l BlockLoop) Validate() error {
+	err := l.validateLayout()
+	if err != nil {
+		return err
+	}
+	for i := range l.Blocks {
+		err = l.Blocks[i].Validate()
+		if err != nil {
+			return fmt.Errorf("block %d at offset %#x: %w", i, l.Blocks[i].Offset, err)
+		}
+	}
+	return nil
+}
+
+// validateLayout checks offsets, links and overlaps of blocks in the loop without validating block contents.
+func (l BlockLoop) validateLayout() error {
+	if len(l.Blocks) == 0 {
+		return errors.New("empty block loop")
+	}
+	var errs []error
+	for i, lb := range l.Blocks {
+		next := l.Blocks[(i+1)%len(l.Blocks)]
+		if lb.Offset < 0 {
+			errs = append(errs, fmt.Errorf("block %d: negative offset %d", i, lb.Offset))
+		} else if lb.Offset%4 != 0 {
+			errs = append(errs, fmt.Errorf("block %d: offset %#x not word aligned", i, lb.Offset))
+		}
+		if lb.Offset+lb.Link != next.Offset {
+			errs = append(errs, fmt.Errorf("block %d: link to offset %#x, want %#x", i, lb.Offset+lb.Link, next.Offset))
+		}
+		for j := 0; j < i; j++ {
+			if lb.Offset < l.Blocks[j].End() && l.Blocks[j].Offset < lb.End() {
+				errs = append(errs, fmt.Errorf("block %d overlaps block %d", i, j))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Insert inserts blk at offset in rom so that it is the i'th block of the loop and recomputes links.
+// Inserting at index Len() places the block last in the loop.
+func (l *BlockLoop) Insert(i int, offset int, blk Block) error {
+	if i < 0 || i > len(l.Blocks) {
+		return fmt.Errorf("insert index %d out of range [0, %d]", i, len(l.Blocks))
+	} else if offset < 0 || offset%4 != 0 {
+		return fmt.Errorf("offset %#x negative or not word aligned", offset)
+	}
+	lb := LoopBlock{Block: blk, Offset: offset}
+	for j := range l.Blocks {
+		if lb.Offset < l.Blocks[j].End() && l.Blocks[j].Offset < lb.End() {
+			return fmt.Errorf("inserted block overlaps block %d", j)
+		}
+	}
+	l.Blocks = append(l.Blocks, LoopBlock{})
+	copy(l.Blocks[i+1:], l.Blocks[i:])
+	l.Blocks[i] = lb
+	l.relink()
+	return nil
+}
+
+// Remove removes the i'th block of the loop and recomputes links. The last remaining block may not be removed.
+func (l *BlockLoop) Remove(i int) error {
+	if i < 0 || i >= len(l.Blocks) {
+		return fmt.Errorf("remove index %d out of range [0, %d)", i, len(l.Blocks))
+	} else if len(l.Blocks) == 1 {
+		return errors.New("cannot remove only block in loop")
+	}
+	l.Blocks = append(l.Blocks[:i], l.Blocks[i+1:]...)
+	l.relink()
+	return nil
+}
+
+// Move moves the block at index from to index to in the loop order and recomputes links.
+// Block offsets in ROM are not modified.
+func (l *BlockLoop) Move(from, to int) error {
+	if from < 0 || from >= len(l.Blocks) || to < 0 || to >= len(l.Blocks) {
+		return fmt.Errorf("move indices %d->%d out of range [0, %d)", from, to, len(l.Blocks))
+	}
+	lb := l.Blocks[from]
+	if from < to {
+		copy(l.Blocks[from:to], l.Blocks[from+1:to+1])
+	} else {
+		copy(l.Blocks[to+1:from+1], l.Blocks[to:from])
+	}
+	l.Blocks[to] = lb
+	l.relink()
+	return nil
+}
+
+// relink recomputes block links so that each block links to the next and the last block links to the first.
+func (l *BlockLoop) relink() {
+	for i := range l.Blocks {
+		next := l.Blocks[(i+1)%len(l.Blocks)]
+		l.Blocks[i].Link = next.Offset - l.Blocks[i].Offset
+	}
+}
+
+// Put writes the binary representation of each block of the loop at its offset in rom.
+// It fails if a block does not fit in rom. rom is not modified if an error is returned.
+func (l BlockLoop) Put(rom []byte) error {
+	for i := range l.Blocks {
+		if l.Blocks[i].Offset < 0 || l.Blocks[i].End() > len(rom) {
+			return fmt.Errorf("block %d at offset %#x does not fit in ROM of length %d", i, l.Blocks[i].Offset, len(rom))
+		}
+	}
+	for i := range l.Blocks {
+		// Capacity is enough to hold block so it is written in place.
+		l.Blocks[i].AppendTo(rom[l.Blocks[i].Offset:l.Blocks[i].Offset])
+	}
+	return nil
+}
@@ -8,7 +8,7 @@ import (
 	"math"
 )
 
-//go:generate stringer -type="ImageType,ExeCPU,ExeChip,ExeSec,ItemType" -linecomment -output stringers.go .
+//go:generate stringer -type="ImageType,ExeCPU,ExeChip,ExeSec,ItemType,SignatureType,HashType" -linecomment -output stringers.go .
 
 // Block delimiters. Are encoded as little endian like all picobin data. They were chosen to be numbers that were very unlikely to appear in ARM machine code.
 const (
@@ -37,7 +37,7 @@ func (b Block) Validate() error {
 	sz := b.Size()
 	if b.Link > math.MaxInt32 || b.Link < math.MinInt32 {
 		return errors.New("block link overflows int32")
-	} else if b.Link < sz && b.Link > -minBlockSize {
+	} else if b.Link != 0 && b.Link < sz && b.Link > -minBlockSize {
 		return errors.New("block link points to memory inside itself or to impossible block")
 	}
 	expectSz := minBlockSize
@@ -232,7 +232,7 @@ func (b Block) AppendTo(dst []byte) []byte {
 
 func appendLastItem(dst []byte, totalSizeItemsBytes int) []byte {
 	item := Item{
-		Head:           byte(ItemTypeLast<<1) | maskByteSize2,
+		Head:           byte(ItemTypeLast) | maskByteSize2,
 		SizeAndSpecial: uint16(totalSizeItemsBytes / 4),
 		TypeData:       0, // pad.
 	}
@@ -241,16 +241,6 @@ func appendLastItem(dst []byte, totalSizeItemsBytes int) []byte {
 	return dst
 }
 
-// func makeLOADMAP(absolute bool, entries []loadMapEntry) {
-// 	sizeWords := 1 + len(entries)
-// 	head := item{head: 0x06, s0mod: uint8(sizeWords % 256), s0div: uint8(sizeWords / 256), tpdata: b2u8(absolute) | uint8(len(entries))<<1}
-// 	for i := range entries {
-// 		head.data = binary.LittleEndian.AppendUint32(head.data, entries[i].storageStartAddr)
-// 		head.data = binary.LittleEndian.AppendUint32(head.data, entries[i].runtimeStartAddr)
-// 		head.data = binary.LittleEndian.AppendUint32(head.data, entries[i].sizeOrEnd)
-// 	}
-// }
-
 func b2u8(b bool) uint8 {
 	if b {
 		return 1
@@ -0,0 +1,77 @@
+package picobin
+
+import (
+	"debug/elf"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/soypat/tinyboot/build/elfutil"
+)
+
+// LoadMapEntriesFromELF returns absolute load map entries derived from the PT_LOAD segments of the ELF
+// stored in ROM. Each entry copies a segment's file contents from its physical (storage) address
+// to its virtual (runtime) address, which is what the bootrom needs to load a packaged RAM image.
+// Segments with no file contents, such as .bss, are not included.
+func LoadMapEntriesFromELF(f *elf.File) ([]LoadMapEntry, error) {
+	var entries []LoadMapEntry
+	for _, prog := range f.Progs {
+		if !elfutil.ProgIsROM(prog) {
+			continue
+		}
+		end := prog.Paddr + prog.Filesz
+		if end > math.MaxUint32 || prog.Vaddr > math.MaxUint32 {
+			return nil, errors.New("ELF segment address overflows 32 bits")
+		}
+		// Sizes are rounded up to a word, trailing bytes are zero padded in storage.
+		end = (end + 3) &^ 3
+		entries = append(entries, LoadMapEntry{
+			StorageStartAbsOrRel: uint32(prog.Paddr),
+			RuntimeStartAbs:      uint32(prog.Vaddr),
+			SizeOrEndAbs:         uint32(end),
+		})
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("no ROM PT_LOAD segments in ELF")
+	}
+	return entries, nil
+}
+
+// SRAMSize is the size of RP2350 SRAM in bytes.
+const SRAMSize = 520 * 1024
+
+// RAMImageFromELF returns the contents of the PT_LOAD segments of an ELF linked to run from RAM laid out at their
+// virtual (runtime) addresses, with gaps between segments zero filled, and the address the image starts at.
+// The result is suitable as the plaintext of [Encrypt]. Segments with no file contents, such as .bss, are not included.
+func RAMImageFromELF(f *elf.File) (image []byte, runtimeAddr uint32, err error) {
+	start, end := uint64(math.MaxUint64), uint64(0)
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD || prog.Filesz == 0 {
+			continue
+		}
+		if prog.Vaddr < start {
+			start = prog.Vaddr
+		}
+		if prog.Vaddr+prog.Filesz > end {
+			end = prog.Vaddr + prog.Filesz
+		}
+	}
+	if end == 0 {
+		return nil, 0, errors.New("no PT_LOAD segments with contents in ELF")
+	} else if end > math.MaxUint32 {
+		return nil, 0, errors.New("ELF segment address overflows 32 bits")
+	} else if end-start > SRAMSize {
+		return nil, 0, fmt.Errorf("ELF segments span %d bytes at %#x, larger than SRAM. Is the ELF linked to run from RAM?", end-start, start)
+	}
+	image = make([]byte, end-start)
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD || prog.Filesz == 0 {
+			continue
+		}
+		_, err = prog.ReadAt(image[prog.Vaddr-start:prog.Vaddr-start+prog.Filesz], 0)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+	return image, uint32(start), nil
+}
@@ -0,0 +1,179 @@
+package picobin
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+const (
+	// AESKeySize is the size of the AES-256 key used to encrypt images.
+	AESKeySize = 32
+	// IVSize is the size of the AES-CTR initialization vector stored in the SALT item of encrypted images.
+	IVSize = aes.BlockSize
+)
+
+// EncryptConfig configures the image created by [Encrypt].
+type EncryptConfig struct {
+	// Key is the AES-256 key used to decrypt the image, i.e: stored in OTP for the loader to read.
+	Key [AESKeySize]byte
+	// IV is the initial AES-CTR counter block, stored in the SALT item. It must be unique for each image encrypted with Key.
+	IV [IVSize]byte
+	// ImageDef is the IMAGE_DEF item of the image. See [MakeImageDef].
+	ImageDef ImageDef
+	// Items are placed after the IMAGE_DEF item, i.e: VECTOR_TABLE, ENTRY_POINT and VERSION items.
+	Items []Item
+	// Signer signs the image if not nil. Encrypted images are always hashed.
+	Signer Signer
+}
+
+// Encrypt packages the plaintext RAM image plain, which runs at address runtimeAddr, into an encrypted image to be
+// stored in flash at flashAddr. The image starts with a single block loop containing the IMAGE_DEF, a SALT item
+// holding the AES-CTR IV, an absolute load map copying the encrypted payload to runtimeAddr and hash or signature items.
+// The payload, encrypted with AES-256 in CTR mode, follows the block. The hash covers the encrypted payload so it can be
+// verified before decrypting. Plain is zero padded to a word.
+//
+// The encrypted image format is specific to this package. It is not the output of picotool's encrypt command and the
+// bootrom does not decrypt it: the payload must be decrypted by a loader implementing [Decrypt] before running it.
+func Encrypt(plain []byte, runtimeAddr, flashAddr uint32, cfg EncryptConfig) ([]byte, error) {
+	if len(plain) == 0 {
+		return nil, errors.New("empty image")
+	} else if runtimeAddr%4 != 0 || flashAddr%4 != 0 {
+		return nil, errors.New("runtime and flash addresses must be word aligned")
+	} else if cfg.ImageDef.ItemType() != ItemTypeImageDef || cfg.ImageDef.Validate() != nil {
+		return nil, errors.New("invalid IMAGE_DEF item")
+	}
+	for i := range cfg.Items {
+		switch tp := cfg.Items[i].ItemType(); tp {
+		case ItemTypeImageDef, ItemTypeSalt, ItemTypeRollingLoadMap, ItemTypeHashDef, ItemTypeHashValue, ItemTypeSignature, ItemTypeLast:
+			return nil, fmt.Errorf("encrypt item %d: %s item is added by Encrypt", i, tp.String())
+		}
+	}
+	salt, err := MakeSalt(cfg.IV[:])
+	if err != nil {
+		return nil, err
+	}
+	payloadSize := (len(plain) + 3) &^ 3
+	// Block size is known before hashing since load map and hash items have a fixed size.
+	lm, err := MakeLoadMap(true, []LoadMapEntry{{}})
+	if err != nil {
+		return nil, err
+	}
+	items := append([]Item{cfg.ImageDef.Item, salt.Item}, cfg.Items...)
+	items = append(items, lm.Item)
+	hv, err := MakeHashValue(make([]byte, sha256.Size))
+	if err != nil {
+		return nil, err
+	}
+	blockSize := minBlockSize + MakeHashDef(HashTypeSHA256, 0).Size() + hv.Size()
+	if cfg.Signer != nil {
+		blockSize += MakeSignature([PublicKeySize]byte{}, [SigSize]byte{}).Size()
+	}
+	for i := range items {
+		blockSize += items[i].Size()
+	}
+	payloadAddr := flashAddr + uint32(blockSize)
+	lm, err = MakeLoadMap(true, []LoadMapEntry{{
+		StorageStartAbsOrRel: payloadAddr,
+		RuntimeStartAbs:      runtimeAddr,
+		SizeOrEndAbs:         payloadAddr + uint32(payloadSize),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	items[len(items)-1] = lm.Item
+
+	image := make([]byte, blockSize+payloadSize)
+	copy(image[blockSize:], plain)
+	err = aesCTR(image[blockSize:], cfg.Key, cfg.IV)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.Signer != nil {
+		items, err = AppendSignatureItems(items, flashAddr, image, flashAddr, cfg.Signer)
+	} else {
+		items, err = AppendHashItems(items, flashAddr, image, flashAddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	blk := Block{Items: items, Link: 0} // Single block loop.
+	err = blk.Validate()
+	if err != nil {
+		return nil, err
+	} else if blk.Size() != blockSize {
+		return nil, fmt.Errorf("encrypted block size %d, expected %d", blk.Size(), blockSize) // Should never happen.
+	}
+	blk.AppendTo(image[:0])
+	return image, nil
+}
+
+// Decrypt verifies the hash of the encrypted image created by [Encrypt] and stored in flash at flashAddr and decrypts
+// its payload with key. It returns the plaintext RAM image and the address it runs at. The image does not record the
+// original plaintext length so the returned plaintext keeps the zero padding to a word added by [Encrypt].
+// Call [VerifySignature] on the image's block to also check its signature.
+func Decrypt(image []byte, flashAddr uint32, key [AESKeySize]byte) (plain []byte, runtimeAddr uint32, err error) {
+	blockOff, err := FirstBlockIdx(image)
+	if err != nil {
+		return nil, 0, err
+	}
+	loop, err := DecodeBlockLoop(image, blockOff)
+	if err != nil {
+		return nil, 0, err
+	}
+	var lb LoopBlock
+	saltIdx := -1
+	for _, lb = range loop.Blocks {
+		saltIdx = findItem(lb.Items, ItemTypeSalt)
+		if saltIdx >= 0 {
+			break
+		}
+	}
+	if saltIdx < 0 {
+		return nil, 0, errors.New("no block with SALT item, image not encrypted")
+	}
+	blockAddr := flashAddr + uint32(lb.Offset)
+	err = VerifyHash(lb.Block, blockAddr, image, flashAddr)
+	if err != nil {
+		return nil, 0, err
+	}
+	var iv [IVSize]byte
+	salt := Salt{Item: lb.Items[saltIdx]}.Salt()
+	if len(salt) != IVSize {
+		return nil, 0, fmt.Errorf("salt length %d, expected %d", len(salt), IVSize)
+	}
+	copy(iv[:], salt)
+	lmIdx := findItem(lb.Items, ItemTypeRollingLoadMap)
+	if lmIdx < 0 {
+		return nil, 0, errors.New("encrypted image has no load map")
+	}
+	entries, err := LoadMap{Item: lb.Items[lmIdx]}.AbsoluteEntries(itemAddr(lb.Items, lmIdx, blockAddr))
+	if err != nil {
+		return nil, 0, err
+	} else if len(entries) != 1 {
+		return nil, 0, fmt.Errorf("encrypted image load map has %d entries, expected 1", len(entries))
+	}
+	entry := entries[0]
+	start, end := int64(entry.StorageStartAbsOrRel)-int64(flashAddr), int64(entry.SizeOrEndAbs)-int64(flashAddr)
+	if start < 0 || end > int64(len(image)) || end < start {
+		return nil, 0, fmt.Errorf("encrypted payload %#x..%#x outside of image", entry.StorageStartAbsOrRel, entry.SizeOrEndAbs)
+	}
+	plain = append([]byte{}, image[start:end]...)
+	err = aesCTR(plain, key, iv)
+	if err != nil {
+		return nil, 0, err
+	}
+	return plain, entry.RuntimeStartAbs, nil
+}
+
+// aesCTR encrypts or decrypts data in place with AES-256 in CTR mode.
+func aesCTR(data []byte, key [AESKeySize]byte, iv [IVSize]byte) error {
+	blk, err := aes.NewCipher(key[:])
+	if err != nil {
+		return err
+	}
+	cipher.NewCTR(blk, iv[:]).XORKeyStream(data, data)
+	return nil
+}
@@ -0,0 +1,131 @@
+package picobin
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// AppendHashItems computes the SHA-256 hash of an image as specified by a HASH_DEF item and returns items with
+// the HASH_DEF and HASH_VALUE items appended. The block containing the items is to be placed at blockAddr.
+// The hash covers the contents of the regions in the block's load map read from rom, which starts at address
+// romAddr, followed by the start of the block up to and including the HASH_DEF item. If items contains no
+// load map an absolute load map covering all of rom is appended before hashing so the bootrom hashes the same
+// regions. The block must not lie inside a hashed region since its contents would change after hashing.
+func AppendHashItems(items []Item, blockAddr uint32, rom []byte, romAddr uint32) ([]Item, error) {
+	for i := range items {
+		switch items[i].ItemType() {
+		case ItemTypeHashDef, ItemTypeHashValue, ItemTypeSignature:
+			return nil, fmt.Errorf("items already contain %s", items[i].ItemType().String())
+		}
+	}
+	items = append([]Item{}, items...)
+	if findItem(items, ItemTypeRollingLoadMap) < 0 {
+		lm, err := MakeLoadMap(true, []LoadMapEntry{{
+			StorageStartAbsOrRel: romAddr,
+			RuntimeStartAbs:      romAddr,
+			SizeOrEndAbs:         romAddr + uint32(len(rom)),
+		}})
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, lm.Item)
+	}
+	// Block words hashed: start marker and all items up to and including the hash def.
+	blockWords := 1 + 2 // Start marker + hash def.
+	for i := range items {
+		blockWords += items[i].SizeWords()
+	}
+	items = append(items, MakeHashDef(HashTypeSHA256, uint16(blockWords)).Item)
+	sum, err := blockHash(items, blockAddr, rom, romAddr)
+	if err != nil {
+		return nil, err
+	}
+	hv, err := MakeHashValue(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return append(items, hv.Item), nil
+}
+
+// VerifyHash recomputes the hash of the image described by the HASH_DEF item of blk and compares it
+// with the block's HASH_VALUE item. blockAddr is the absolute address of the block and rom contains the image
+// starting at romAddr. If the block has no load map the hash is computed over all of rom.
+func VerifyHash(blk Block, blockAddr uint32, rom []byte, romAddr uint32) error {
+	hvIdx := findItem(blk.Items, ItemTypeHashValue)
+	if hvIdx < 0 {
+		return errors.New("block has no hash value item")
+	}
+	sum, err := blockHash(blk.Items, blockAddr, rom, romAddr)
+	if err != nil {
+		return err
+	}
+	want := HashValue{Item: blk.Items[hvIdx]}.Hash()
+	if len(want) > len(sum) {
+		return fmt.Errorf("hash value length %d exceeds hash size", len(want))
+	} else if !bytes.Equal(want, sum[:len(want)]) {
+		return fmt.Errorf("hash mismatch: computed %x, block contains %x", sum[:len(want)], want)
+	}
+	return nil
+}
+
+// ImageHash computes the SHA-256 hash over the storage contents of the absolute load map entries read from rom
+// followed by blockPrefix, which is the start of the block up to the number of words specified by HASH_DEF.
+func ImageHash(entries []LoadMapEntry, rom []byte, romAddr uint32, blockPrefix []byte) ([sha256.Size]byte, error) {
+	h := sha256.New()
+	for i, entry := range entries {
+		start, end := entry.StorageStartAbsOrRel, entry.SizeOrEndAbs
+		if start < romAddr || end < start || uint64(end-romAddr) > uint64(len(rom)) {
+			return [sha256.Size]byte{}, fmt.Errorf("load map entry %d storage %#x..%#x outside of image %#x..%#x", i, start, end, romAddr, romAddr+uint32(len(rom)))
+		}
+		h.Write(rom[start-romAddr : end-romAddr])
+	}
+	h.Write(blockPrefix)
+	var sum [sha256.Size]byte
+	h.Sum(sum[:0])
+	return sum, nil
+}
+
+func blockHash(items []Item, blockAddr uint32, rom []byte, romAddr uint32) (sum [sha256.Size]byte, err error) {
+	hdIdx := findItem(items, ItemTypeHashDef)
+	if hdIdx < 0 {
+		return sum, errors.New("block has no hash def item")
+	}
+	hd := HashDef{Item: items[hdIdx]}
+	if hd.HashType() != HashTypeSHA256 {
+		return sum, fmt.Errorf("unsupported hash type %s", hd.HashType().String())
+	}
+	entries := []LoadMapEntry{{StorageStartAbsOrRel: romAddr, RuntimeStartAbs: romAddr, SizeOrEndAbs: romAddr + uint32(len(rom))}}
+	if lmIdx := findItem(items, ItemTypeRollingLoadMap); lmIdx >= 0 {
+		entries, err = LoadMap{Item: items[lmIdx]}.AbsoluteEntries(itemAddr(items, lmIdx, blockAddr))
+		if err != nil {
+			return sum, err
+		}
+	}
+	blockText := Block{Items: items}.AppendTo(nil)
+	hashedSize := 4 * hd.BlockWordsHashed()
+	if hashedSize > len(blockText) {
+		return sum, fmt.Errorf("hash def block words %d exceeds block size", hd.BlockWordsHashed())
+	}
+	return ImageHash(entries, rom, romAddr, blockText[:hashedSize])
+}
+
+// findItem returns the index of the first item of type tp in items or -1 if not found.
+func findItem(items []Item, tp ItemType) int {
+	for i := range items {
+		if items[i].ItemType() == tp {
+			return i
+		}
+	}
+	return -1
+}
+
+// itemAddr returns the absolute address of the header of items[idx] in a block starting at blockAddr.
+func itemAddr(items []Item, idx int, blockAddr uint32) uint32 {
+	addr := blockAddr + 4
+	for i := 0; i < idx; i++ {
+		addr += uint32(items[i].Size())
+	}
+	return addr
+}
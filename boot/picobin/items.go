@@ -1,6 +1,9 @@
 package picobin
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 type Item struct {
 	Head uint8 // [0:1]:size_flag(0 means 1 byte size, 1 means 2 byte size) [1:7]: item type.
@@ -73,6 +76,26 @@ func (it Item) String() string {
 		return ImageDef{Item: it}.String()
 	case ItemTypeRollingLoadMap:
 		return LoadMap{Item: it}.String()
+	case ItemTypeVectorTable:
+		return VectorTable{Item: it}.String()
+	case ItemTypeRollingWindowDelta:
+		return RollingWindowDelta{Item: it}.String()
+	case ItemTypeSignature:
+		return Signature{Item: it}.String()
+	case ItemTypePartitionTable:
+		return PartitionTable{Item: it}.String()
+	case ItemTypeSalt:
+		return Salt{Item: it}.String()
+	case ItemTypeNextBlockOffset:
+		return NextBlockOffset{Item: it}.String()
+	case ItemTypeEntryPoint:
+		return EntryPoint{Item: it}.String()
+	case ItemTypeHashDef:
+		return HashDef{Item: it}.String()
+	case ItemTypeVersion:
+		return Version{Item: it}.String()
+	case ItemTypeHashValue:
+		return HashValue{Item: it}.String()
 	}
 	return fmt.Sprintf("Item(%s, size=%d)", it.ItemType(), it.Size())
 }
@@ -83,7 +106,7 @@ type ImageDef struct {
 
 func MakeImageDef(img ImageType, exesec ExeSec, execpu ExeCPU, exechip ExeChip, tryBeforeYouBuy bool) ImageDef {
 	return ImageDef{Item: rawMakeItem(ItemTypeImageDef, 1,
-		uint8(0b111&img)|uint8((0b11&exesec)<<4),
+		uint8(0b1111&img)|uint8((0b11&exesec)<<4),
 		0b111&uint8(execpu)|(uint8(0b111&exechip)<<4)|b2u8(tryBeforeYouBuy)<<7,
 		nil,
 	)}
@@ -104,11 +127,15 @@ const (
 	ExeCPURISCV               // RISCV
 )
 
+// ExeSec is the security mode of an executable image, stored in bits 4..5 of the IMAGE_DEF image type flags.
+// ExeSecNonSecure and ExeSecSecure have the values 1 and 2 used by the bootrom. Earlier versions of this
+// package numbered them 0 and 1, so raw ExeSec values stored by callers must be converted.
 type ExeSec uint8
 
 const (
-	ExeSecNonSecure ExeSec = iota // Non-Secure
-	ExeSecSecure                  // Secure
+	ExeSecUnspecified ExeSec = iota // unspecified
+	ExeSecNonSecure                 // Non-Secure
+	ExeSecSecure                    // Secure
 )
 
 type ExeChip uint8
@@ -118,12 +145,14 @@ const (
 	ExeChipRP2350                // RP2350
 )
 
+// ImageType returns the image type stored in bits 0..3 of the image type flags.
 func (imgdef ImageDef) ImageType() ImageType {
-	return ImageType(imgdef.SizeAndSpecial) & 0b111
+	return ImageType(imgdef.SizeAndSpecial>>8) & 0b1111
 }
 
+// ExeSec returns the executable security stored in bits 4..5 of the image type flags.
 func (imgdef ImageDef) ExeSec() ExeSec {
-	return ExeSec(imgdef.SizeAndSpecial>>4) & 0b111
+	return ExeSec(imgdef.SizeAndSpecial>>12) & 0b11
 }
 
 func (imgdef ImageDef) ExeCPU() ExeCPU {
@@ -149,7 +178,7 @@ func (imgdef ImageDef) String() string {
 
 func rawMakeItem(itemtype ItemType, szMod, szDivOrData, tpdata uint8, data []byte) Item {
 	var szmask uint8
-	if itemtype == ItemTypeIgnored || itemtype == ItemTypeLast || len(data) > 255 {
+	if itemtype == ItemTypeIgnored || itemtype == ItemTypeLast || 1+len(data)/4 > 255 {
 		szmask = maskByteSize2
 	}
 	sizeAndSpecial := uint16(szMod) | uint16(szDivOrData)<<8
@@ -186,19 +215,75 @@ func (lm LoadMap) String() string {
 	return fmt.Sprintf("LoadMap(abs=%v, entries=%d)", lm.IsAbsolute(), entries)
 }
 
+// MakeLoadMap creates a LOAD_MAP item. If absolute is set entries have absolute storage start and end addresses,
+// otherwise storage start addresses are relative to the address of the entry's first word and sizes are used.
+func MakeLoadMap(absolute bool, entries []LoadMapEntry) (LoadMap, error) {
+	if len(entries) > maxLoadMapEntries {
+		return LoadMap{}, fmt.Errorf("too many load map entries %d, max %d", len(entries), maxLoadMapEntries)
+	}
+	data := make([]byte, 0, 12*len(entries))
+	for i := range entries {
+		err := entries[i].validate(absolute)
+		if err != nil {
+			return LoadMap{}, fmt.Errorf("load map entry %d: %w", i, err)
+		}
+		data = appendWords(data, entries[i].StorageStartAbsOrRel, entries[i].RuntimeStartAbs, entries[i].SizeOrEndAbs)
+	}
+	return LoadMap{Item: makeItem(ItemTypeRollingLoadMap, 0, b2u8(absolute)<<7|uint8(len(entries)), data)}, nil
+}
+
+const maxLoadMapEntries = 0x7f
+
+// IsAbsolute returns true if the storage addresses of the entries are absolute.
 func (lm LoadMap) IsAbsolute() bool {
-	return lm.Item.TypeData&1 != 0
+	return lm.Item.TypeData&(1<<7) != 0
 }
 
+// NumEntries returns the number of entries in the load map or -1 if the number of
+// entries in the header does not match the item size.
 func (lm LoadMap) NumEntries() int {
-	entries := lm.SizeWords() - 1
-	entries2 := lm.TypeData >> 1
-	if entries != int(entries2) {
+	entries := int(lm.TypeData & maxLoadMapEntries)
+	if lm.SizeWords() != 1+3*entries || len(lm.Data) != 12*entries {
 		return -1
 	}
 	return entries
 }
 
+// Entries decodes the load map entries as stored in the item. See [LoadMap.AbsoluteEntries]
+// to obtain entries with absolute addresses regardless of the load map form.
+func (lm LoadMap) Entries() ([]LoadMapEntry, error) {
+	n := lm.NumEntries()
+	if n < 0 {
+		return nil, errors.New("load map size does not match number of entries")
+	}
+	entries := make([]LoadMapEntry, n)
+	for i := range entries {
+		entries[i] = LoadMapEntry{
+			StorageStartAbsOrRel: lm.word(3 * i),
+			RuntimeStartAbs:      lm.word(3*i + 1),
+			SizeOrEndAbs:         lm.word(3*i + 2),
+		}
+	}
+	return entries, nil
+}
+
+// AbsoluteEntries decodes the load map entries and converts them to absolute form, that is, with
+// absolute storage start and end addresses. itemAddr is the absolute address of the load map item header
+// and is used to resolve relative storage addresses.
+func (lm LoadMap) AbsoluteEntries(itemAddr uint32) ([]LoadMapEntry, error) {
+	entries, err := lm.Entries()
+	if err != nil || lm.IsAbsolute() {
+		return entries, err
+	}
+	for i := range entries {
+		entryAddr := itemAddr + 4 + 12*uint32(i)
+		start := entryAddr + entries[i].StorageStartAbsOrRel
+		entries[i].StorageStartAbsOrRel = start
+		entries[i].SizeOrEndAbs += start
+	}
+	return entries, nil
+}
+
 // LoadMapEntry specifies a binary blob to be loaded. All addresses must be word aligned and sizes a multiple of word size (4 for RP2040 and RP2350).
 type LoadMapEntry struct {
 	StorageStartAbsOrRel uint32 // Storage start address relative to this word if not absolute, absolute storage start address if absolute.
@@ -206,6 +291,15 @@ type LoadMapEntry struct {
 	SizeOrEndAbs         uint32 // Size in bytes if not absolute, storage end address if absolute.
 }
 
+func (lme LoadMapEntry) validate(absolute bool) error {
+	if (lme.StorageStartAbsOrRel|lme.RuntimeStartAbs|lme.SizeOrEndAbs)%4 != 0 {
+		return errors.New("load map addresses and sizes must be word aligned")
+	} else if absolute && lme.SizeOrEndAbs < lme.StorageStartAbsOrRel {
+		return errors.New("load map storage end address before start")
+	}
+	return nil
+}
+
 func makeIgnoredItem() Item {
 	return rawMakeItem(ItemTypeIgnored, 1, 0, 0, nil)
 }
@@ -0,0 +1,388 @@
+package picobin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// SignatureType identifies the signature algorithm of a [Signature] item.
+type SignatureType uint8
+
+const (
+	SignatureTypeNone      SignatureType = iota // none
+	SignatureTypeSecp256k1                      // secp256k1
+)
+
+// HashType identifies the hash algorithm of a [HashDef] item.
+type HashType uint8
+
+const (
+	HashTypeNone   HashType = iota // none
+	HashTypeSHA256                 // SHA-256
+)
+
+// Sizes of secp256k1 signature item fields.
+const (
+	PublicKeySize = 64 // Uncompressed secp256k1 public key (X, Y) without prefix byte.
+	SigSize       = 64 // secp256k1 signature (R, S).
+)
+
+// VectorTable is an item specifying the address of the ARM vector table used to find the initial
+// stack pointer and entry point of the image when no [EntryPoint] item is present.
+type VectorTable struct {
+	Item
+}
+
+// MakeVectorTable creates a VECTOR_TABLE item pointing to the vector table at addr.
+func MakeVectorTable(addr uint32) VectorTable {
+	return VectorTable{Item: makeItem(ItemTypeVectorTable, 0, 0, appendWords(nil, addr))}
+}
+
+// Addr returns the absolute address of the vector table.
+func (vt VectorTable) Addr() uint32 { return vt.word(0) }
+
+func (vt VectorTable) String() string {
+	if len(vt.Data) != 4 {
+		return "InvalidVectorTable()"
+	}
+	return fmt.Sprintf("VectorTable(%#x)", vt.Addr())
+}
+
+// RollingWindowDelta is an item specifying the offset the flash address translation must apply
+// to the image so that its runtime addresses match its link addresses. The delta is a multiple of 4096.
+type RollingWindowDelta struct {
+	Item
+}
+
+// MakeRollingWindowDelta creates a ROLLING_WINDOW_DELTA item.
+func MakeRollingWindowDelta(delta int32) RollingWindowDelta {
+	return RollingWindowDelta{Item: makeItem(ItemTypeRollingWindowDelta, 0, 0, appendWords(nil, uint32(delta)))}
+}
+
+// Delta returns the rolling window delta in bytes.
+func (rwd RollingWindowDelta) Delta() int32 { return int32(rwd.word(0)) }
+
+func (rwd RollingWindowDelta) String() string {
+	if len(rwd.Data) != 4 {
+		return "InvalidRollingWindowDelta()"
+	}
+	return fmt.Sprintf("RollingWindowDelta(%#x)", rwd.Delta())
+}
+
+// Signature is an item containing the public key and signature over the image hash used for secure boot.
+type Signature struct {
+	Item
+}
+
+// MakeSignature creates a SIGNATURE item of secp256k1 type.
+func MakeSignature(publicKey [PublicKeySize]byte, sig [SigSize]byte) Signature {
+	data := make([]byte, 0, PublicKeySize+SigSize)
+	data = append(data, publicKey[:]...)
+	data = append(data, sig[:]...)
+	return Signature{Item: makeItem(ItemTypeSignature, 0, uint8(SignatureTypeSecp256k1), data)}
+}
+
+// SignatureType returns the signature algorithm.
+func (sig Signature) SignatureType() SignatureType { return SignatureType(sig.TypeData) }
+
+// PublicKey returns the public key the signature should be verified with.
+func (sig Signature) PublicKey() (publicKey [PublicKeySize]byte) {
+	copy(publicKey[:], sig.Data)
+	return publicKey
+}
+
+// Sig returns the signature bytes.
+func (sig Signature) Sig() (signature [SigSize]byte) {
+	if len(sig.Data) >= PublicKeySize {
+		copy(signature[:], sig.Data[PublicKeySize:])
+	}
+	return signature
+}
+
+func (sig Signature) String() string {
+	if len(sig.Data) != PublicKeySize+SigSize {
+		return "InvalidSignature()"
+	}
+	return fmt.Sprintf("Signature(%s, key=%x...)", sig.SignatureType().String(), sig.Data[:8])
+}
+
+// Salt is an item containing a salt used for encrypted images.
+type Salt struct {
+	Item
+}
+
+// MakeSalt creates a SALT item. The salt length must be a multiple of 4.
+func MakeSalt(salt []byte) (Salt, error) {
+	if len(salt) == 0 || len(salt)%4 != 0 {
+		return Salt{}, errors.New("salt length must be non-zero multiple of 4")
+	}
+	return Salt{Item: makeItem(ItemTypeSalt, 0, 0, append([]byte{}, salt...))}, nil
+}
+
+// Salt returns the salt bytes.
+func (s Salt) Salt() []byte { return s.Data }
+
+func (s Salt) String() string {
+	return fmt.Sprintf("Salt(%x)", s.Data)
+}
+
+// NextBlockOffset is an item specifying the offset in bytes from the start of this block
+// to the next block, used by images that are moved after being loaded.
+type NextBlockOffset struct {
+	Item
+}
+
+// MakeNextBlockOffset creates a NEXT_BLOCK_OFFSET item.
+func MakeNextBlockOffset(offset int32) NextBlockOffset {
+	return NextBlockOffset{Item: makeItem(ItemTypeNextBlockOffset, 0, 0, appendWords(nil, uint32(offset)))}
+}
+
+// Offset returns the offset in bytes to the next block.
+func (nbo NextBlockOffset) Offset() int32 { return int32(nbo.word(0)) }
+
+func (nbo NextBlockOffset) String() string {
+	if len(nbo.Data) != 4 {
+		return "InvalidNextBlockOffset()"
+	}
+	return fmt.Sprintf("NextBlockOffset(%d)", nbo.Offset())
+}
+
+// EntryPoint is an item specifying the initial program counter and stack pointer of the image,
+// taking precedence over the vector table.
+type EntryPoint struct {
+	Item
+}
+
+// MakeEntryPoint creates an ENTRY_POINT item. If spLimit is zero the stack limit is omitted.
+func MakeEntryPoint(pc, sp, spLimit uint32) EntryPoint {
+	data := appendWords(nil, pc, sp)
+	if spLimit != 0 {
+		data = appendWords(data, spLimit)
+	}
+	return EntryPoint{Item: makeItem(ItemTypeEntryPoint, 0, 0, data)}
+}
+
+// PC returns the initial program counter.
+func (ep EntryPoint) PC() uint32 { return ep.word(0) }
+
+// SP returns the initial stack pointer.
+func (ep EntryPoint) SP() uint32 { return ep.word(1) }
+
+// SPLimit returns the stack pointer limit and true if present.
+func (ep EntryPoint) SPLimit() (uint32, bool) { return ep.word(2), len(ep.Data) == 12 }
+
+func (ep EntryPoint) String() string {
+	if len(ep.Data) != 8 && len(ep.Data) != 12 {
+		return "InvalidEntryPoint()"
+	}
+	if lim, ok := ep.SPLimit(); ok {
+		return fmt.Sprintf("EntryPoint(pc=%#x, sp=%#x, splim=%#x)", ep.PC(), ep.SP(), lim)
+	}
+	return fmt.Sprintf("EntryPoint(pc=%#x, sp=%#x)", ep.PC(), ep.SP())
+}
+
+// HashDef is an item defining how the image hash is computed. The hash covers the
+// contents specified by the load map (or the whole image) followed by the
+// first BlockWordsHashed words of the block containing the HashDef.
+type HashDef struct {
+	Item
+}
+
+// MakeHashDef creates a HASH_DEF item.
+func MakeHashDef(hashType HashType, blockWordsHashed uint16) HashDef {
+	return HashDef{Item: makeItem(ItemTypeHashDef, 0, uint8(hashType), appendWords(nil, uint32(blockWordsHashed)))}
+}
+
+// HashType returns the hash algorithm.
+func (hd HashDef) HashType() HashType { return HashType(hd.TypeData) }
+
+// BlockWordsHashed returns the number of words at the start of the block included in the hash.
+func (hd HashDef) BlockWordsHashed() int { return int(uint16(hd.word(0))) }
+
+func (hd HashDef) String() string {
+	if len(hd.Data) != 4 {
+		return "InvalidHashDef()"
+	}
+	return fmt.Sprintf("HashDef(%s, words=%d)", hd.HashType().String(), hd.BlockWordsHashed())
+}
+
+// Version is an item specifying the image version. If OTP rows are given the image also
+// has a rollback version which is checked against the thermometer coded OTP rows.
+type Version struct {
+	Item
+}
+
+// rollbackBitsPerRow is the number of thermometer code bits stored in each rollback OTP row.
+const rollbackBitsPerRow = 24
+
+// MakeVersion creates a VERSION item. The rollback version is only stored if otpRows is not empty, in which case
+// otpRows must have enough bits to thermometer code the rollback version.
+func MakeVersion(major, minor, rollback uint16, otpRows []uint16) (Version, error) {
+	if len(otpRows) > 255 {
+		return Version{}, errors.New("too many OTP rows")
+	} else if len(otpRows) == 0 && rollback != 0 {
+		return Version{}, errors.New("rollback version requires OTP rows")
+	} else if int(rollback) > rollbackBitsPerRow*len(otpRows) {
+		return Version{}, fmt.Errorf("rollback version %d exceeds %d OTP rows capacity", rollback, len(otpRows))
+	}
+	data := appendWords(nil, uint32(major)<<16|uint32(minor))
+	if len(otpRows) > 0 {
+		halfwords := append([]uint16{rollback}, otpRows...)
+		if len(halfwords)%2 != 0 {
+			halfwords = append(halfwords, 0)
+		}
+		for i := range halfwords {
+			data = binary.LittleEndian.AppendUint16(data, halfwords[i])
+		}
+	}
+	return Version{Item: makeItem(ItemTypeVersion, 0, uint8(len(otpRows)), data)}, nil
+}
+
+// Major returns the major version.
+func (v Version) Major() uint16 { return uint16(v.word(0) >> 16) }
+
+// Minor returns the minor version.
+func (v Version) Minor() uint16 { return uint16(v.word(0)) }
+
+// NumOTPRows returns the number of OTP rows declared in the item header.
+func (v Version) NumOTPRows() int { return int(v.TypeData) }
+
+// Rollback returns the rollback version. It is zero if there are no OTP rows.
+func (v Version) Rollback() uint16 { return v.halfword(4) }
+
+// OTPRows returns the OTP rows containing the thermometer coded minimum rollback version.
+func (v Version) OTPRows() []uint16 {
+	n := v.NumOTPRows()
+	if n == 0 || len(v.Data) < 6+2*n {
+		return nil
+	}
+	rows := make([]uint16, n)
+	for i := range rows {
+		rows[i] = v.halfword(6 + 2*i)
+	}
+	return rows
+}
+
+// HasRollback returns true if the version has a rollback version, i.e: it specifies OTP rows.
+func (v Version) HasRollback() bool { return v.NumOTPRows() > 0 }
+
+// Compare returns -1, 0 or +1 depending on whether v is older than, equal to or newer than w
+// as compared by the bootrom when choosing between A/B partitions: rollback versions take precedence over
+// major and minor versions. The zero value Version, i.e: no VERSION item, is version 0.0 with rollback version 0.
+func (v Version) Compare(w Version) int {
+	vk, wk := v.key(), w.key()
+	switch {
+	case vk < wk:
+		return -1
+	case vk > wk:
+		return 1
+	}
+	return 0
+}
+
+func (v Version) key() uint64 {
+	if v.ItemType() != ItemTypeVersion || !v.validSize() {
+		return 0
+	}
+	return uint64(v.Rollback())<<32 | uint64(v.Major())<<16 | uint64(v.Minor())
+}
+
+// CheckUpgrade returns an error if replacing an image of version old with an image of version v would
+// be rejected by a chip with secure boot enabled that booted old, which happens when the rollback version decreases.
+// It also fails if v drops the rollback version or stores it in different OTP rows than old.
+// It does not check that v is newer than old, use [Version.Compare] for that.
+func (v Version) CheckUpgrade(old Version) error {
+	if !old.HasRollback() {
+		return nil
+	} else if !v.HasRollback() {
+		return fmt.Errorf("version %d.%d has no rollback version, previous rollback version %d", v.Major(), v.Minor(), old.Rollback())
+	} else if v.Rollback() < old.Rollback() {
+		return fmt.Errorf("rollback version decreased from %d to %d", old.Rollback(), v.Rollback())
+	}
+	oldRows, rows := old.OTPRows(), v.OTPRows()
+	if len(oldRows) != len(rows) {
+		return fmt.Errorf("rollback OTP rows changed from %#x to %#x", oldRows, rows)
+	}
+	for i := range rows {
+		if rows[i] != oldRows[i] {
+			return fmt.Errorf("rollback OTP rows changed from %#x to %#x", oldRows, rows)
+		}
+	}
+	return nil
+}
+
+func (v Version) validSize() bool {
+	n := v.NumOTPRows()
+	if n == 0 {
+		return len(v.Data) == 4
+	}
+	return len(v.Data) == 4+4*((n+2)/2)
+}
+
+func (v Version) String() string {
+	if !v.validSize() {
+		return "InvalidVersion()"
+	}
+	if v.NumOTPRows() > 0 {
+		return fmt.Sprintf("Version(%d.%d, rollback=%d, rows=%d)", v.Major(), v.Minor(), v.Rollback(), v.OTPRows())
+	}
+	return fmt.Sprintf("Version(%d.%d)", v.Major(), v.Minor())
+}
+
+// HashValue is an item containing the image hash, possibly truncated, as defined by [HashDef].
+type HashValue struct {
+	Item
+}
+
+// MakeHashValue creates a HASH_VALUE item. The hash length must be a multiple of 4.
+func MakeHashValue(hash []byte) (HashValue, error) {
+	if len(hash) == 0 || len(hash)%4 != 0 {
+		return HashValue{}, errors.New("hash length must be non-zero multiple of 4")
+	}
+	return HashValue{Item: makeItem(ItemTypeHashValue, 0, 0, append([]byte{}, hash...))}, nil
+}
+
+// Hash returns the hash bytes.
+func (hv HashValue) Hash() []byte { return hv.Data }
+
+func (hv HashValue) String() string {
+	return fmt.Sprintf("HashValue(%x)", hv.Data)
+}
+
+// makeItem creates an item calculating its size from data. special is stored in
+// the second size byte unless the item is larger than 255 words and requires a 2 byte size,
+// in which case special must be zero or makeItem panics.
+func makeItem(itemtype ItemType, special, tpdata uint8, data []byte) Item {
+	sizeWords := 1 + len(data)/4
+	if sizeWords > 255 {
+		if special != 0 {
+			panic("item special byte does not fit with 2 byte size")
+		}
+		special = uint8(sizeWords >> 8) // rawMakeItem sets 2 byte size flag.
+	}
+	return rawMakeItem(itemtype, uint8(sizeWords), special, tpdata, data)
+}
+
+// word returns the i'th data word of the item or 0 if out of range.
+func (it Item) word(i int) uint32 {
+	if len(it.Data) < 4*i+4 {
+		return 0
+	}
+	return binary.LittleEndian.Uint32(it.Data[4*i:])
+}
+
+// halfword returns the data halfword at byte offset off or 0 if out of range.
+func (it Item) halfword(off int) uint16 {
+	if len(it.Data) < off+2 {
+		return 0
+	}
+	return binary.LittleEndian.Uint16(it.Data[off:])
+}
+
+func appendWords(dst []byte, words ...uint32) []byte {
+	for _, w := range words {
+		dst = binary.LittleEndian.AppendUint32(dst, w)
+	}
+	return dst
+}
@@ -0,0 +1,375 @@
+package picobin
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// FlashSectorSize is the size in bytes of the flash sectors partitions are defined in.
+const FlashSectorSize = 4096
+
+// Partition table limits.
+const (
+	MaxPartitions         = 16
+	maxPartitionSector    = 0x1fff // 13 bit sector fields.
+	maxExtraFamilies      = 3
+	maxPartitionNameLen   = 0x7f
+	partitionCountMask    = 0x1f
+	partitionSingletonBit = 1 << 7
+)
+
+// PartitionPermissions are the access permissions of a partition for secure code (S), non-secure code (NS)
+// and the bootloader (BOOT), such as when writing UF2s or using picotool. They are stored in bits 26..31 of both
+// partition words.
+type PartitionPermissions uint8
+
+const (
+	PermSecureRead PartitionPermissions = 1 << iota
+	PermSecureWrite
+	PermNonSecureRead
+	PermNonSecureWrite
+	PermBootRead
+	PermBootWrite
+
+	PermAll PartitionPermissions = 0x3f
+
+	permissionsShift = 26
+)
+
+func (perms PartitionPermissions) String() string {
+	var sb strings.Builder
+	names := [3]string{"S", "NS", "BOOT"}
+	for i, name := range names {
+		if i > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(name)
+		sb.WriteByte(':')
+		rw := []byte("--")
+		if perms&(PermSecureRead<<(2*i)) != 0 {
+			rw[0] = 'r'
+		}
+		if perms&(PermSecureWrite<<(2*i)) != 0 {
+			rw[1] = 'w'
+		}
+		sb.Write(rw)
+	}
+	return sb.String()
+}
+
+// PartitionFlags are the flags of a partition stored in its second word alongside the permissions. Fields
+// encoded in the flags word that are represented elsewhere in [Partition] (ID, name, link and extra families)
+// must not be set.
+type PartitionFlags uint32
+
+// Partition flags. Families accepted determine which UF2 family IDs may be downloaded into a partition.
+const (
+	// PartitionFlagUF2DownloadABNonBootableOwnerAffinity makes UF2 downloads to an A/B pair of owned partitions
+	// target the partition whose owner is not bootable.
+	PartitionFlagUF2DownloadABNonBootableOwnerAffinity PartitionFlags = 1 << 9
+	// PartitionFlagUF2DownloadNoReboot prevents the bootloader from rebooting after a UF2 download to the partition.
+	PartitionFlagUF2DownloadNoReboot      PartitionFlags = 1 << 10
+	PartitionFlagAcceptsFamilyAbsolute    PartitionFlags = 1 << 13
+	PartitionFlagAcceptsFamilyRP2040      PartitionFlags = 1 << 14
+	PartitionFlagAcceptsFamilyRP2350ARMS  PartitionFlags = 1 << 15
+	PartitionFlagAcceptsFamilyRP2350RISCV PartitionFlags = 1 << 16
+	PartitionFlagAcceptsFamilyRP2350ARMNS PartitionFlags = 1 << 17
+	PartitionFlagAcceptsFamilyData        PartitionFlags = 1 << 18
+	PartitionFlagNotBootableARM           PartitionFlags = 1 << 19
+	PartitionFlagNotBootableRISCV         PartitionFlags = 1 << 20
+
+	partitionFlagHasID      = 1 << 0
+	partitionLinkTypeShift  = 1
+	partitionLinkValueShift = 3
+	partitionNumExtraShift  = 7
+	partitionFlagHasName    = 1 << 12
+	partitionFlagsEncoded   = partitionFlagHasID | 0b11<<partitionLinkTypeShift | 0xf<<partitionLinkValueShift | 0b11<<partitionNumExtraShift | partitionFlagHasName
+	partitionFlagsValid     = 0x1fe600 | partitionFlagsEncoded
+)
+
+var partitionFlagNames = [...]struct {
+	flag PartitionFlags
+	name string
+}{
+	{PartitionFlagUF2DownloadABNonBootableOwnerAffinity, "ab-non-bootable-owner-affinity"},
+	{PartitionFlagUF2DownloadNoReboot, "no-reboot"},
+	{PartitionFlagAcceptsFamilyAbsolute, "absolute"},
+	{PartitionFlagAcceptsFamilyRP2040, "rp2040"},
+	{PartitionFlagAcceptsFamilyRP2350ARMS, "rp2350-arm-s"},
+	{PartitionFlagAcceptsFamilyRP2350RISCV, "rp2350-riscv"},
+	{PartitionFlagAcceptsFamilyRP2350ARMNS, "rp2350-arm-ns"},
+	{PartitionFlagAcceptsFamilyData, "data"},
+	{PartitionFlagNotBootableARM, "not-bootable-arm"},
+	{PartitionFlagNotBootableRISCV, "not-bootable-riscv"},
+}
+
+func (flags PartitionFlags) String() string {
+	var names []string
+	for _, f := range partitionFlagNames {
+		if flags&f.flag != 0 {
+			names = append(names, f.name)
+		}
+	}
+	if other := flags &^ (partitionFlagsValid &^ partitionFlagsEncoded); other != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint32(other)))
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, "|")
+}
+
+// LinkType specifies the relation of a partition to the partition referenced by its link value.
+type LinkType uint8
+
+const (
+	// LinkTypeNone means the partition is not linked.
+	LinkTypeNone LinkType = iota
+	// LinkTypeAPartition means the partition is the B partition of the linked A partition.
+	LinkTypeAPartition
+	// LinkTypeOwnerPartition means the partition is owned by the linked partition, i.e: a data partition belonging to an image.
+	LinkTypeOwnerPartition
+)
+
+// Partition is a single entry of a [PartitionTable]. The partition spans whole
+// flash sectors from FirstSector to LastSector inclusive.
+type Partition struct {
+	FirstSector uint16
+	LastSector  uint16
+	Permissions PartitionPermissions
+	Flags       PartitionFlags
+	LinkType    LinkType
+	LinkValue   uint8 // Index of linked partition.
+	HasID       bool
+	ID          uint64
+	// ExtraFamilies are family IDs the partition accepts in addition to those in Flags. Up to 3.
+	ExtraFamilies []uint32
+	Name          string
+}
+
+// Start returns the offset in bytes of the partition from the start of flash.
+func (p Partition) Start() uint32 { return uint32(p.FirstSector) * FlashSectorSize }
+
+// End returns the offset in bytes of the end of the partition from the start of flash (exclusive).
+func (p Partition) End() uint32 { return (uint32(p.LastSector) + 1) * FlashSectorSize }
+
+// Validate checks the partition fields are representable in a partition table.
+func (p Partition) Validate() error {
+	var errs []error
+	if p.FirstSector > p.LastSector {
+		errs = append(errs, fmt.Errorf("first sector %d after last sector %d", p.FirstSector, p.LastSector))
+	}
+	if p.LastSector > maxPartitionSector {
+		errs = append(errs, fmt.Errorf("last sector %d exceeds %d", p.LastSector, maxPartitionSector))
+	}
+	if p.Permissions&^PermAll != 0 {
+		errs = append(errs, errors.New("invalid permission bits"))
+	}
+	if p.Flags&partitionFlagsEncoded != 0 || p.Flags&^partitionFlagsValid != 0 {
+		errs = append(errs, fmt.Errorf("invalid flag bits %#x", uint32(p.Flags)))
+	}
+	if p.LinkType > LinkTypeOwnerPartition {
+		errs = append(errs, fmt.Errorf("invalid link type %d", p.LinkType))
+	} else if p.LinkValue >= MaxPartitions {
+		errs = append(errs, fmt.Errorf("link value %d exceeds max partitions", p.LinkValue))
+	} else if p.LinkType == LinkTypeNone && p.LinkValue != 0 {
+		errs = append(errs, errors.New("link value set with no link type"))
+	}
+	if len(p.ExtraFamilies) > maxExtraFamilies {
+		errs = append(errs, fmt.Errorf("%d extra families exceeds max of %d", len(p.ExtraFamilies), maxExtraFamilies))
+	}
+	if len(p.Name) > maxPartitionNameLen {
+		errs = append(errs, fmt.Errorf("name length %d exceeds %d", len(p.Name), maxPartitionNameLen))
+	}
+	return errors.Join(errs...)
+}
+
+func (p Partition) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Partition(%#x..%#x, %s, flags=%s", p.Start(), p.End(), p.Permissions.String(), p.Flags.String())
+	if p.Name != "" {
+		fmt.Fprintf(&sb, ", name=%q", p.Name)
+	}
+	if p.HasID {
+		fmt.Fprintf(&sb, ", id=%#x", p.ID)
+	}
+	switch p.LinkType {
+	case LinkTypeAPartition:
+		fmt.Fprintf(&sb, ", a=%d", p.LinkValue)
+	case LinkTypeOwnerPartition:
+		fmt.Fprintf(&sb, ", owner=%d", p.LinkValue)
+	}
+	for _, fam := range p.ExtraFamilies {
+		fmt.Fprintf(&sb, ", family=%#x", fam)
+	}
+	sb.WriteByte(')')
+	return sb.String()
+}
+
+func (p Partition) appendTo(dst []byte) []byte {
+	perms := uint32(p.Permissions) << permissionsShift
+	location := perms | uint32(p.FirstSector) | uint32(p.LastSector)<<13
+	flags := perms | uint32(p.Flags) | uint32(p.LinkType)<<partitionLinkTypeShift |
+		uint32(p.LinkValue)<<partitionLinkValueShift | uint32(len(p.ExtraFamilies))<<partitionNumExtraShift
+	if p.HasID {
+		flags |= partitionFlagHasID
+	}
+	if p.Name != "" {
+		flags |= partitionFlagHasName
+	}
+	dst = appendWords(dst, location, flags)
+	if p.HasID {
+		dst = appendWords(dst, uint32(p.ID), uint32(p.ID>>32))
+	}
+	dst = appendWords(dst, p.ExtraFamilies...)
+	if p.Name != "" {
+		dst = append(dst, byte(len(p.Name)))
+		dst = append(dst, p.Name...)
+		for len(dst)%4 != 0 {
+			dst = append(dst, 0)
+		}
+	}
+	return dst
+}
+
+// PartitionTable is an item describing the partitions of flash memory. Partitions
+// are used to hold several images in flash, i.e: for A/B updates.
+type PartitionTable struct {
+	Item
+}
+
+// NumPartitions returns the number of partitions declared in the item header.
+func (pt PartitionTable) NumPartitions() int { return int(pt.TypeData & partitionCountMask) }
+
+// IsSingleton returns true if the partition table is the only one in flash and
+// the bootrom need not look for a second partition table.
+func (pt PartitionTable) IsSingleton() bool { return pt.TypeData&partitionSingletonBit != 0 }
+
+func (pt PartitionTable) String() string {
+	if len(pt.Data) < 4 {
+		return "InvalidPartitionTable()"
+	}
+	if pt.IsSingleton() {
+		return fmt.Sprintf("PartitionTable(partitions=%d, singleton)", pt.NumPartitions())
+	}
+	return fmt.Sprintf("PartitionTable(partitions=%d)", pt.NumPartitions())
+}
+
+// MakePartitionTable creates a PARTITION_TABLE item. unpartitionedPerms and unpartitionedFlags apply to flash not
+// covered by any partition, only family flags are meaningful for unpartitioned space. If singleton is set the
+// bootrom will not look for a second partition table. Partitions are validated with [ValidatePartitions].
+func MakePartitionTable(singleton bool, unpartitionedPerms PartitionPermissions, unpartitionedFlags PartitionFlags, partitions []Partition) (PartitionTable, error) {
+	err := ValidatePartitions(partitions)
+	if err != nil {
+		return PartitionTable{}, err
+	}
+	unpartitioned := Partition{Permissions: unpartitionedPerms, Flags: unpartitionedFlags}
+	if err := unpartitioned.Validate(); err != nil {
+		return PartitionTable{}, fmt.Errorf("unpartitioned space: %w", err)
+	}
+	data := appendWords(nil, uint32(unpartitionedPerms)<<permissionsShift|uint32(unpartitionedFlags))
+	for i := range partitions {
+		data = partitions[i].appendTo(data)
+	}
+	tpdata := uint8(len(partitions))
+	if singleton {
+		tpdata |= partitionSingletonBit
+	}
+	return PartitionTable{Item: makeItem(ItemTypePartitionTable, 0, tpdata, data)}, nil
+}
+
+// ValidatePartitions checks each partition with [Partition.Validate] and checks
+// partitions do not overlap and links reference existing partitions.
+func ValidatePartitions(partitions []Partition) error {
+	if len(partitions) > MaxPartitions {
+		return fmt.Errorf("%d partitions exceeds max of %d", len(partitions), MaxPartitions)
+	}
+	var errs []error
+	for i, p := range partitions {
+		if err := p.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("partition %d: %w", i, err))
+			continue
+		}
+		if p.LinkType != LinkTypeNone && (int(p.LinkValue) >= len(partitions) || int(p.LinkValue) == i) {
+			errs = append(errs, fmt.Errorf("partition %d: links to invalid partition %d", i, p.LinkValue))
+		}
+		for j := 0; j < i; j++ {
+			q := partitions[j]
+			if p.FirstSector <= q.LastSector && q.FirstSector <= p.LastSector {
+				errs = append(errs, fmt.Errorf("partition %d overlaps partition %d", i, j))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Unpartitioned returns the permissions and flags applied to flash not covered by a partition.
+func (pt PartitionTable) Unpartitioned() (PartitionPermissions, PartitionFlags) {
+	w := pt.word(0)
+	return PartitionPermissions(w >> permissionsShift), PartitionFlags(w) & (1<<permissionsShift - 1)
+}
+
+// Partitions decodes the partitions of the table.
+func (pt PartitionTable) Partitions() ([]Partition, error) {
+	n := pt.NumPartitions()
+	if n > MaxPartitions {
+		return nil, fmt.Errorf("%d partitions exceeds max of %d", n, MaxPartitions)
+	} else if len(pt.Data) < 4 {
+		return nil, errors.New("partition table missing unpartitioned space word")
+	}
+	partitions := make([]Partition, n)
+	wordIdx := 1
+	for i := range partitions {
+		if len(pt.Data) < 4*(wordIdx+2) {
+			return nil, fmt.Errorf("partition %d: short data", i)
+		}
+		location, flags := pt.word(wordIdx), pt.word(wordIdx+1)
+		wordIdx += 2
+		p := Partition{
+			FirstSector: uint16(location & maxPartitionSector),
+			LastSector:  uint16(location >> 13 & maxPartitionSector),
+			Permissions: PartitionPermissions(location >> permissionsShift),
+			Flags:       PartitionFlags(flags) & (partitionFlagsValid &^ partitionFlagsEncoded),
+			LinkType:    LinkType(flags >> partitionLinkTypeShift & 0b11),
+			LinkValue:   uint8(flags >> partitionLinkValueShift & 0xf),
+			HasID:       flags&partitionFlagHasID != 0,
+		}
+		if PartitionPermissions(flags>>permissionsShift) != p.Permissions {
+			return nil, fmt.Errorf("partition %d: permissions mismatch between location and flags", i)
+		}
+		numExtra := int(flags >> partitionNumExtraShift & 0b11)
+		need := numExtra
+		if p.HasID {
+			need += 2
+		}
+		if len(pt.Data) < 4*(wordIdx+need) {
+			return nil, fmt.Errorf("partition %d: short data", i)
+		}
+		if p.HasID {
+			p.ID = uint64(pt.word(wordIdx)) | uint64(pt.word(wordIdx+1))<<32
+			wordIdx += 2
+		}
+		for j := 0; j < numExtra; j++ {
+			p.ExtraFamilies = append(p.ExtraFamilies, pt.word(wordIdx))
+			wordIdx++
+		}
+		if flags&partitionFlagHasName != 0 {
+			off := 4 * wordIdx
+			if off >= len(pt.Data) {
+				return nil, fmt.Errorf("partition %d: short name", i)
+			}
+			nameLen := int(pt.Data[off] & maxPartitionNameLen)
+			if off+1+nameLen > len(pt.Data) {
+				return nil, fmt.Errorf("partition %d: short name", i)
+			}
+			p.Name = string(pt.Data[off+1 : off+1+nameLen])
+			wordIdx += (1 + nameLen + 3) / 4
+		}
+		partitions[i] = p
+	}
+	if 4*wordIdx != len(pt.Data) {
+		return partitions, fmt.Errorf("partition table has %d trailing bytes", len(pt.Data)-4*wordIdx)
+	}
+	return partitions, nil
+}
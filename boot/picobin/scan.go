@@ -0,0 +1,71 @@
+package picobin
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// BlockCandidate is an occurrence of the block start marker in the bootrom's search window. See [ScanBlocks].
+type BlockCandidate struct {
+	// Offset is the offset of the start marker relative to the start of ROM.
+	Offset int
+	// Loop is the block loop starting at the candidate. Only valid if Err is nil.
+	Loop BlockLoop
+	// Err is the reason the candidate is skipped, nil if it starts a valid block loop.
+	Err error
+}
+
+// ScanBlocks returns every occurrence of the block start marker in the first [FlashSectorSize] bytes of rom, the window
+// the bootrom searches for the first block of a block loop, and tries to decode the block loop starting at each.
+// Since the marker bytes may also appear in data, such as literal pools, candidates that are not word aligned or do not
+// start a valid block loop are skipped by the bootrom. The reason a candidate is skipped is stored in its Err field.
+func ScanBlocks(rom []byte) []BlockCandidate {
+	window := rom
+	if len(window) > FlashSectorSize {
+		window = window[:FlashSectorSize]
+	}
+	return scanBlocks(window, func(off int) (BlockLoop, error) { return DecodeBlockLoop(rom, off) })
+}
+
+// scanBlocks returns the candidates found in the search window with the loop decoded by decodeLoop.
+func scanBlocks(window []byte, decodeLoop func(off int) (BlockLoop, error)) []BlockCandidate {
+	var cands []BlockCandidate
+	for off := 0; off < len(window); off++ {
+		idx := bytes.Index(window[off:], startMarker)
+		if idx < 0 {
+			break
+		}
+		off += idx
+		cand := BlockCandidate{Offset: off}
+		if off%4 != 0 {
+			cand.Err = errors.New("start marker not word aligned")
+		} else {
+			cand.Loop, cand.Err = decodeLoop(off)
+		}
+		cands = append(cands, cand)
+	}
+	return cands
+}
+
+// FirstBlockIdx returns the offset of the first block of the block loop the bootrom finds in rom, which is the first
+// candidate returned by [ScanBlocks] that starts a valid block loop. Unlike [NextBlockIdx] it tolerates block start marker
+// bytes appearing in data before the first block.
+func FirstBlockIdx(rom []byte) (int, error) {
+	return firstCandidate(ScanBlocks(rom))
+}
+
+// firstCandidate returns the offset of the first valid candidate or an error with the reasons all candidates were skipped.
+func firstCandidate(cands []BlockCandidate) (int, error) {
+	if len(cands) == 0 {
+		return -1, errors.New("block start marker not found in first sector")
+	}
+	errs := make([]error, len(cands))
+	for i, cand := range cands {
+		if cand.Err == nil {
+			return cand.Offset, nil
+		}
+		errs[i] = fmt.Errorf("candidate at offset %#x: %w", cand.Offset, cand.Err)
+	}
+	return -1, fmt.Errorf("no valid block loop in first sector: %w", errors.Join(errs...))
+}
@@ -0,0 +1,97 @@
+package picobin
+
+import (
+	"errors"
+	"fmt"
+)
+
+// SealConfig configures the block added to an image by [Seal].
+type SealConfig struct {
+	// ImageDef is the IMAGE_DEF item of the new block. See [MakeImageDef].
+	ImageDef ImageDef
+	// Items are placed after the IMAGE_DEF item, i.e: VECTOR_TABLE, ENTRY_POINT, VERSION and LOAD_MAP items.
+	Items []Item
+	// Hash adds HASH_DEF and HASH_VALUE items to the block. See [AppendHashItems].
+	Hash bool
+	// Signer signs the image if not nil, which implies Hash. See [AppendSignatureItems].
+	Signer Signer
+}
+
+// Seal adds a block containing the IMAGE_DEF and items specified by cfg to the block loop of rom, which
+// starts at address romAddr, and returns the sealed ROM and the address of the new block. This is the
+// equivalent of `picotool seal`.
+//
+// The new block is placed after the end of rom aligned to a word and is linked after the last block of the
+// existing loop, which must be found in rom. IMAGE_DEF items in existing blocks are replaced
+// with IGNORED items of the same size so the new IMAGE_DEF is the only one in the loop.
+// rom is not modified.
+func Seal(rom []byte, romAddr uint32, cfg SealConfig) (sealed []byte, blockAddr uint32, err error) {
+	if cfg.ImageDef.ItemType() != ItemTypeImageDef || cfg.ImageDef.Validate() != nil {
+		return nil, 0, errors.New("invalid IMAGE_DEF item")
+	}
+	for i := range cfg.Items {
+		switch tp := cfg.Items[i].ItemType(); tp {
+		case ItemTypeImageDef, ItemTypeHashDef, ItemTypeHashValue, ItemTypeSignature, ItemTypeLast:
+			return nil, 0, fmt.Errorf("seal item %d: %s item is added by Seal", i, tp.String())
+		}
+	}
+	block0Off, err := FirstBlockIdx(rom)
+	if err != nil {
+		return nil, 0, err
+	}
+	loop, err := DecodeBlockLoop(rom, block0Off)
+	if err != nil {
+		return nil, 0, err
+	}
+	sealed = make([]byte, len(rom), len(rom)+256)
+	copy(sealed, rom)
+	for len(sealed)%4 != 0 {
+		sealed = append(sealed, 0)
+	}
+	blockOff := len(sealed)
+	blockAddr = romAddr + uint32(blockOff)
+
+	// Replace existing IMAGE_DEFs and link the last block of the loop to the new block.
+	for i := range loop.Blocks {
+		items := make([]Item, len(loop.Blocks[i].Items))
+		copy(items, loop.Blocks[i].Items)
+		for j := range items {
+			if items[j].ItemType() == ItemTypeImageDef {
+				items[j] = makeIgnoredItemSized(items[j].SizeWords())
+			}
+		}
+		loop.Blocks[i].Items = items
+	}
+	items := append([]Item{cfg.ImageDef.Item}, cfg.Items...)
+	err = loop.Insert(loop.Len(), blockOff, Block{Items: items})
+	if err != nil {
+		return nil, 0, err
+	}
+	// Existing blocks are written before hashing since their contents are hashed. The new block is appended last.
+	err = BlockLoop{Blocks: loop.Blocks[:loop.Len()-1]}.Put(sealed)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch {
+	case cfg.Signer != nil:
+		items, err = AppendSignatureItems(items, blockAddr, sealed, romAddr, cfg.Signer)
+	case cfg.Hash:
+		items, err = AppendHashItems(items, blockAddr, sealed, romAddr)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	newBlock := &loop.Blocks[loop.Len()-1]
+	newBlock.Items = items
+	err = loop.Validate()
+	if err != nil {
+		return nil, 0, err
+	}
+	return newBlock.AppendTo(sealed), blockAddr, nil
+}
+
+// makeIgnoredItemSized returns an IGNORED item of sizeWords words with zeroed data.
+func makeIgnoredItemSized(sizeWords int) Item {
+	return Item{Head: byte(ItemTypeIgnored) | maskByteSize2, SizeAndSpecial: uint16(sizeWords), Data: make([]byte, 4*sizeWords-4)}
+}
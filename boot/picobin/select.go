@@ -0,0 +1,287 @@
+package picobin
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+)
+
+// BootConfig is the chip state the RP2350 bootrom takes into account when selecting an image to boot,
+// mostly read from OTP. The zero value is a chip running on ARM with secure boot disabled.
+type BootConfig struct {
+	// CPU is the architecture the bootrom is running on.
+	CPU ExeCPU
+	// SecureBoot is set when OTP CRIT1.SECURE_BOOT_ENABLE is set. Images must then be signed by one of KeyHashes
+	// and have a rollback version not lower than RollbackVersion.
+	SecureBoot bool
+	// KeyHashes are the SHA-256 hashes of the public keys stored in the OTP BOOTKEY rows. See [PublicKeyHash].
+	KeyHashes [][sha256.Size]byte
+	// RollbackVersion is the minimum rollback version thermometer coded in OTP. Only used with SecureBoot.
+	RollbackVersion uint16
+	// FlashUpdate is set when booting right after a flash update, i.e. after a UF2 download. TBYB images are only bootable then.
+	FlashUpdate bool
+	// DisableAutoSwitchArch is set when OTP BOOT_FLAGS0.DISABLE_AUTO_SWITCH_ARCH is set. Otherwise the
+	// bootrom reboots into the other architecture if only an image for it is found.
+	DisableAutoSwitchArch bool
+}
+
+// BootCandidate is an IMAGE_DEF considered by the bootrom during image selection.
+type BootCandidate struct {
+	// Partition is the index of the partition the image is in, or -1 if not selecting from a partition table.
+	Partition int
+	// Block is the index of the block containing the IMAGE_DEF in its block loop.
+	Block int
+	// Addr is the address of the block.
+	Addr     uint32
+	ImageDef ImageDef
+	// Version is the VERSION item of the block. Its Item is the zero value if the block has none.
+	Version Version
+	// Rejected is the reason the image was not selected. It is nil only for the selected image.
+	Rejected error
+}
+
+func (bc BootCandidate) String() string {
+	s := fmt.Sprintf("BLOCK%d @ Addr=%#x %s", bc.Block, bc.Addr, bc.ImageDef.String())
+	if bc.Partition >= 0 {
+		s = fmt.Sprintf("partition %d %s", bc.Partition, s)
+	}
+	if bc.Rejected != nil {
+		s += ": " + bc.Rejected.Error()
+	}
+	return s
+}
+
+// BootSelection is the result of simulating the bootrom image selection.
+type BootSelection struct {
+	// Candidates are all IMAGE_DEFs found, in the order the bootrom considers them.
+	Candidates []BootCandidate
+	// Selected is the index in Candidates of the image the bootrom boots, or -1 if no image is bootable.
+	Selected int
+	// ArchSwitch is set if the selected image is for the other architecture, requiring the bootrom to reboot into it.
+	ArchSwitch bool
+}
+
+// Image returns the selected candidate and true, or false if no image is bootable.
+func (bs BootSelection) Image() (BootCandidate, bool) {
+	if bs.Selected < 0 {
+		return BootCandidate{}, false
+	}
+	return bs.Candidates[bs.Selected], true
+}
+
+// PublicKeyHash returns the hash of the public key as stored in the OTP BOOTKEY rows.
+func PublicKeyHash(publicKey [PublicKeySize]byte) [sha256.Size]byte {
+	return sha256.Sum256(publicKey[:])
+}
+
+var errArchMismatch = errors.New("image CPU does not match bootrom architecture")
+
+// SelectImage simulates the RP2350 bootrom's selection of the IMAGE_DEF to boot from loop, which is decoded from rom starting at romAddr.
+// Like the bootrom, the last bootable IMAGE_DEF in loop order is selected. If no image is bootable on cfg.CPU the last
+// image bootable on the other architecture is selected unless cfg.DisableAutoSwitchArch is set.
+func SelectImage(loop BlockLoop, rom []byte, romAddr uint32, cfg BootConfig) BootSelection {
+	sel := BootSelection{Selected: -1}
+	var blocks []Block
+	for i, lb := range loop.Blocks {
+		idx := findItem(lb.Items, ItemTypeImageDef)
+		if idx < 0 {
+			continue
+		}
+		cand := BootCandidate{
+			Partition: -1,
+			Block:     i,
+			Addr:      romAddr + uint32(lb.Offset),
+			ImageDef:  ImageDef{Item: lb.Items[idx]},
+		}
+		if vidx := findItem(lb.Items, ItemTypeVersion); vidx >= 0 {
+			cand.Version = Version{Item: lb.Items[vidx]}
+		}
+		cand.Rejected = checkBootable(lb.Block, cand, rom, romAddr, cfg)
+		sel.Candidates = append(sel.Candidates, cand)
+		blocks = append(blocks, lb.Block)
+	}
+	sel.Selected = lastIndex(sel.Candidates, func(i int) bool { return sel.Candidates[i].Rejected == nil })
+	if sel.Selected < 0 && !cfg.DisableAutoSwitchArch {
+		other := cfg
+		other.CPU = otherCPU(cfg.CPU)
+		sel.Selected = lastIndex(sel.Candidates, func(i int) bool {
+			c := sel.Candidates[i]
+			return errors.Is(c.Rejected, errArchMismatch) && checkBootable(blocks[i], c, rom, romAddr, other) == nil
+		})
+		sel.ArchSwitch = sel.Selected >= 0
+	}
+	if sel.Selected >= 0 {
+		sel.Candidates[sel.Selected].Rejected = nil
+		for i := range sel.Candidates {
+			if i != sel.Selected && sel.Candidates[i].Rejected == nil {
+				sel.Candidates[i].Rejected = fmt.Errorf("later IMAGE_DEF in BLOCK%d selected", sel.Candidates[sel.Selected].Block)
+			}
+		}
+	}
+	return sel
+}
+
+// SelectPartitionImage simulates the RP2350 bootrom's image selection with a partition table. rom is the contents of flash,
+// which is mapped at romAddr. Each partition's image is selected with [SelectImage] from the block loop found in the partition's
+// first sector, see [FirstBlockIdx]. Partitions are considered in order and the first partition with a bootable image is selected.
+// For A/B partition pairs the bootable image with the higher version is selected, preferring A when versions are equal.
+// Partitions marked not bootable for cfg.CPU are skipped. Candidate addresses are the translated addresses images run at.
+func SelectPartitionImage(parts []Partition, rom []byte, romAddr uint32, cfg BootConfig) BootSelection {
+	partSel := make([]BootSelection, len(parts))
+	for i, p := range parts {
+		partSel[i] = selectPartition(i, p, rom, romAddr, cfg)
+	}
+	sel := BootSelection{Selected: -1}
+	for a, p := range parts {
+		if p.LinkType == LinkTypeAPartition {
+			continue // B partitions are considered along with their A partition.
+		}
+		group := []int{a}
+		for b, pb := range parts {
+			if pb.LinkType == LinkTypeAPartition && int(pb.LinkValue) == a && b != a {
+				group = append(group, b)
+			}
+		}
+		choice := -1
+		for _, i := range group {
+			img, ok := partSel[i].Image()
+			if !ok {
+				continue
+			}
+			if choice < 0 {
+				choice = i
+				continue
+			}
+			chosen, _ := partSel[choice].Image()
+			if chosen.Version.Compare(img.Version) < 0 {
+				partSel[choice].reject(fmt.Errorf("partition %d has higher version", i))
+				choice = i
+			} else {
+				partSel[i].reject(fmt.Errorf("partition %d has equal or higher version", choice))
+			}
+		}
+		for _, i := range group {
+			if choice == i && sel.Selected < 0 {
+				sel.Selected = len(sel.Candidates) + partSel[i].Selected
+				sel.ArchSwitch = partSel[i].ArchSwitch
+			} else if choice == i {
+				partSel[i].reject(fmt.Errorf("earlier partition %d selected", sel.Candidates[sel.Selected].Partition))
+			}
+			sel.Candidates = append(sel.Candidates, partSel[i].Candidates...)
+		}
+	}
+	return sel
+}
+
+// selectPartition selects the image of a single partition.
+func selectPartition(idx int, p Partition, rom []byte, romAddr uint32, cfg BootConfig) BootSelection {
+	start := int(p.Start())
+	end := int(p.End())
+	if start >= len(rom) {
+		return BootSelection{Selected: -1}
+	} else if end > len(rom) {
+		end = len(rom)
+	}
+	prom := rom[start:end]
+	block0Off, err := FirstBlockIdx(prom)
+	if err != nil {
+		return BootSelection{Selected: -1}
+	}
+	loop, err := DecodeBlockLoop(prom, block0Off)
+	if err != nil {
+		return BootSelection{Selected: -1}
+	}
+	// Partition is mapped to the start of flash by address translation so images are linked to run at romAddr.
+	sel := SelectImage(loop, prom, romAddr, cfg)
+	for i := range sel.Candidates {
+		sel.Candidates[i].Partition = idx
+	}
+	notBootable := cfg.CPU == ExeCPUARM && p.Flags&PartitionFlagNotBootableARM != 0 ||
+		cfg.CPU == ExeCPURISCV && p.Flags&PartitionFlagNotBootableRISCV != 0
+	if notBootable {
+		sel.reject(fmt.Errorf("partition not bootable on %s", cfg.CPU.String()))
+	}
+	return sel
+}
+
+// reject unselects the selected image, if any, with the reason err.
+func (bs *BootSelection) reject(err error) {
+	if bs.Selected < 0 {
+		return
+	}
+	bs.Candidates[bs.Selected].Rejected = err
+	bs.Selected = -1
+	bs.ArchSwitch = false
+}
+
+// checkBootable returns the reason the image defined in blk may not be booted by the bootrom or nil if it is bootable.
+func checkBootable(blk Block, cand BootCandidate, rom []byte, romAddr uint32, cfg BootConfig) error {
+	imgdef := cand.ImageDef
+	switch {
+	case imgdef.ImageType() != ImageTypeExecutable:
+		return fmt.Errorf("image type %s not executable", imgdef.ImageType().String())
+	case imgdef.ExeChip() != ExeChipRP2350:
+		return fmt.Errorf("image for chip %s", imgdef.ExeChip().String())
+	case imgdef.ExeCPU() != cfg.CPU:
+		return errArchMismatch
+	case cfg.CPU == ExeCPUARM && imgdef.ExeSec() == ExeSecNonSecure:
+		return errors.New("non-secure ARM image can only be launched by secure code")
+	case imgdef.TryBeforeYouBuy() && !cfg.FlashUpdate:
+		return errors.New("TBYB image only bootable right after a flash update")
+	}
+	if findItem(blk.Items, ItemTypeHashValue) >= 0 {
+		err := VerifyHash(blk, cand.Addr, rom, romAddr)
+		if err != nil {
+			return err
+		}
+	}
+	if !cfg.SecureBoot {
+		return nil
+	}
+	sigIdx := findItem(blk.Items, ItemTypeSignature)
+	if sigIdx < 0 {
+		return errors.New("secure boot enabled and image not signed")
+	}
+	pub := Signature{Item: blk.Items[sigIdx]}.PublicKey()
+	keyHash := PublicKeyHash(pub)
+	found := false
+	for _, h := range cfg.KeyHashes {
+		found = found || h == keyHash
+	}
+	if !found {
+		return fmt.Errorf("signing key hash %x not in OTP boot keys", keyHash)
+	}
+	err := VerifySignature(blk, cand.Addr, rom, romAddr, pub)
+	if err != nil {
+		return err
+	}
+	if rollback := candidateRollback(cand); rollback < cfg.RollbackVersion {
+		return fmt.Errorf("rollback version %d less than OTP rollback version %d", rollback, cfg.RollbackVersion)
+	}
+	return nil
+}
+
+// candidateRollback returns the rollback version of the candidate, which is zero if it has none.
+func candidateRollback(cand BootCandidate) uint16 {
+	if cand.Version.ItemType() != ItemTypeVersion || !cand.Version.validSize() {
+		return 0
+	}
+	return cand.Version.Rollback()
+}
+
+func otherCPU(cpu ExeCPU) ExeCPU {
+	if cpu == ExeCPUARM {
+		return ExeCPURISCV
+	}
+	return ExeCPUARM
+}
+
+// lastIndex returns the last index in s for which f returns true, or -1.
+func lastIndex[T any](s []T, f func(i int) bool) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if f(i) {
+			return i
+		}
+	}
+	return -1
+}
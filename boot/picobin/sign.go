@@ -0,0 +1,315 @@
+package picobin
+
+import (
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/soypat/tinyboot/internal/secp256k1"
+)
+
+// Signer signs image hashes for RP2350 secure boot. Implement Signer to keep private
+// keys in a hardware security module or signing service.
+type Signer interface {
+	// PublicKey returns the secp256k1 public key in the format stored in the SIGNATURE item:
+	// X followed by Y, each 32 bytes little endian.
+	PublicKey() [PublicKeySize]byte
+	// SignDigest returns the secp256k1 ECDSA signature of a SHA-256 digest in the format stored in the
+	// SIGNATURE item: R followed by S, each 32 bytes little endian.
+	SignDigest(digest [sha256.Size]byte) ([SigSize]byte, error)
+}
+
+var (
+	oidPublicKeyECDSA = asn1.ObjectIdentifier{1, 2, 840, 10045, 2, 1}
+	oidSecp256k1      = asn1.ObjectIdentifier{1, 3, 132, 0, 10}
+)
+
+// PrivateKey is a secp256k1 private key that implements [Signer]. Signing is not constant time,
+// prefer an external [Signer] when signing on shared machines.
+type PrivateKey struct {
+	d   *big.Int
+	pub [PublicKeySize]byte
+}
+
+var _ Signer = (*PrivateKey)(nil)
+
+// GeneratePrivateKey generates a new secp256k1 private key using randomness from rand.
+func GeneratePrivateKey(rand io.Reader) (*PrivateKey, error) {
+	d, err := secp256k1.GenerateKey(rand)
+	if err != nil {
+		return nil, err
+	}
+	return newPrivateKey(d), nil
+}
+
+func newPrivateKey(d *big.Int) *PrivateKey {
+	return &PrivateKey{d: d, pub: pointToKey(secp256k1.ScalarBaseMult(d))}
+}
+
+// ecPrivateKey is the SEC 1 ASN.1 structure of an EC private key.
+type ecPrivateKey struct {
+	Version       int
+	PrivateKey    []byte
+	NamedCurveOID asn1.ObjectIdentifier `asn1:"optional,explicit,tag:0"`
+	PublicKey     asn1.BitString        `asn1:"optional,explicit,tag:1"`
+}
+
+// pkcs8 is the ASN.1 structure of a PKCS #8 private key.
+type pkcs8 struct {
+	Version    int
+	Algo       pkix.AlgorithmIdentifier
+	PrivateKey []byte
+}
+
+// subjectPublicKeyInfo is the ASN.1 structure of a PKIX public key.
+type subjectPublicKeyInfo struct {
+	Algo      pkix.AlgorithmIdentifier
+	PublicKey asn1.BitString
+}
+
+// ParsePrivateKeyPEM parses a secp256k1 private key in SEC 1 ("EC PRIVATE KEY") or PKCS #8 ("PRIVATE KEY")
+// PEM format as generated by `openssl ecparam -name secp256k1 -genkey`. EC PARAMETERS blocks are skipped.
+func ParsePrivateKeyPEM(data []byte) (*PrivateKey, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, errors.New("no private key PEM block found")
+		}
+		switch block.Type {
+		case "EC PARAMETERS":
+			continue
+		case "EC PRIVATE KEY":
+			return parseSEC1(block.Bytes, true)
+		case "PRIVATE KEY":
+			var key pkcs8
+			_, err := asn1.Unmarshal(block.Bytes, &key)
+			if err != nil {
+				return nil, fmt.Errorf("parsing PKCS #8 private key: %w", err)
+			} else if !key.Algo.Algorithm.Equal(oidPublicKeyECDSA) {
+				return nil, errors.New("PKCS #8 private key is not an EC key")
+			}
+			err = checkCurveParams(key.Algo.Parameters.FullBytes)
+			if err != nil {
+				return nil, err
+			}
+			return parseSEC1(key.PrivateKey, false)
+		default:
+			return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+		}
+	}
+}
+
+func parseSEC1(der []byte, needCurve bool) (*PrivateKey, error) {
+	var key ecPrivateKey
+	_, err := asn1.Unmarshal(der, &key)
+	if err != nil {
+		return nil, fmt.Errorf("parsing EC private key: %w", err)
+	} else if key.Version != 1 {
+		return nil, fmt.Errorf("unknown EC private key version %d", key.Version)
+	} else if (needCurve || len(key.NamedCurveOID) > 0) && !key.NamedCurveOID.Equal(oidSecp256k1) {
+		return nil, fmt.Errorf("EC private key curve %s is not secp256k1", key.NamedCurveOID)
+	}
+	d := new(big.Int).SetBytes(key.PrivateKey)
+	if d.Sign() <= 0 || d.Cmp(secp256k1.N) >= 0 {
+		return nil, errors.New("invalid secp256k1 private key")
+	}
+	return newPrivateKey(d), nil
+}
+
+func checkCurveParams(params []byte) error {
+	var curve asn1.ObjectIdentifier
+	_, err := asn1.Unmarshal(params, &curve)
+	if err != nil {
+		return fmt.Errorf("parsing EC curve: %w", err)
+	} else if !curve.Equal(oidSecp256k1) {
+		return fmt.Errorf("EC key curve %s is not secp256k1", curve)
+	}
+	return nil
+}
+
+// MarshalPEM encodes the private key in SEC 1 ("EC PRIVATE KEY") PEM format.
+func (k *PrivateKey) MarshalPEM() ([]byte, error) {
+	var d [32]byte
+	k.d.FillBytes(d[:])
+	pub := k.publicPoint()
+	der, err := asn1.Marshal(ecPrivateKey{
+		Version:       1,
+		PrivateKey:    d[:],
+		NamedCurveOID: oidSecp256k1,
+		PublicKey:     asn1.BitString{Bytes: uncompressed(pub), BitLength: 8 * 65},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
+
+// PublicKey returns the public key as stored in the SIGNATURE item. See [Signer].
+func (k *PrivateKey) PublicKey() [PublicKeySize]byte { return k.pub }
+
+// MarshalPublicKeyPEM encodes the public key in PKIX ("PUBLIC KEY") PEM format.
+func (k *PrivateKey) MarshalPublicKeyPEM() ([]byte, error) {
+	params, err := asn1.Marshal(oidSecp256k1)
+	if err != nil {
+		return nil, err
+	}
+	der, err := asn1.Marshal(subjectPublicKeyInfo{
+		Algo:      pkix.AlgorithmIdentifier{Algorithm: oidPublicKeyECDSA, Parameters: asn1.RawValue{FullBytes: params}},
+		PublicKey: asn1.BitString{Bytes: uncompressed(k.publicPoint()), BitLength: 8 * 65},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// SignDigest signs the digest with a deterministic nonce. See [Signer].
+func (k *PrivateKey) SignDigest(digest [sha256.Size]byte) (sig [SigSize]byte, err error) {
+	r, s, err := secp256k1.Sign(k.d, digest[:])
+	if err != nil {
+		return sig, err
+	}
+	putLE256(sig[:32], r)
+	putLE256(sig[32:], s)
+	return sig, nil
+}
+
+func (k *PrivateKey) publicPoint() secp256k1.Point {
+	pub, _ := keyToPoint(k.pub)
+	return pub
+}
+
+// ParsePublicKeyPEM parses a secp256k1 public key in PKIX ("PUBLIC KEY") PEM format and returns it
+// in the format stored in the SIGNATURE item.
+func ParsePublicKeyPEM(data []byte) (publicKey [PublicKeySize]byte, err error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return publicKey, errors.New("no public key PEM block found")
+		} else if block.Type != "PUBLIC KEY" {
+			continue
+		}
+		var spki subjectPublicKeyInfo
+		_, err = asn1.Unmarshal(block.Bytes, &spki)
+		if err != nil {
+			return publicKey, fmt.Errorf("parsing public key: %w", err)
+		} else if !spki.Algo.Algorithm.Equal(oidPublicKeyECDSA) {
+			return publicKey, errors.New("public key is not an EC key")
+		}
+		err = checkCurveParams(spki.Algo.Parameters.FullBytes)
+		if err != nil {
+			return publicKey, err
+		}
+		raw := spki.PublicKey.RightAlign()
+		if len(raw) != 65 || raw[0] != 4 {
+			return publicKey, errors.New("public key is not an uncompressed point")
+		}
+		p := secp256k1.Point{X: new(big.Int).SetBytes(raw[1:33]), Y: new(big.Int).SetBytes(raw[33:])}
+		if !p.IsOnCurve() {
+			return publicKey, errors.New("public key not on secp256k1 curve")
+		}
+		return pointToKey(p), nil
+	}
+}
+
+// AppendSignatureItems hashes the image as [AppendHashItems] does if items do not already contain a HASH_DEF and
+// appends a SIGNATURE item with the signer's signature over the hash. The resulting items are to be placed
+// in a block at blockAddr.
+func AppendSignatureItems(items []Item, blockAddr uint32, rom []byte, romAddr uint32, signer Signer) ([]Item, error) {
+	if findItem(items, ItemTypeSignature) >= 0 {
+		return nil, errors.New("items already contain signature")
+	}
+	var err error
+	if findItem(items, ItemTypeHashDef) < 0 {
+		items, err = AppendHashItems(items, blockAddr, rom, romAddr)
+		if err != nil {
+			return nil, err
+		}
+	}
+	digest, err := blockHash(items, blockAddr, rom, romAddr)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := signer.SignDigest(digest)
+	if err != nil {
+		return nil, fmt.Errorf("signing image: %w", err)
+	}
+	return append(items[:len(items):len(items)], MakeSignature(signer.PublicKey(), sig).Item), nil
+}
+
+// VerifySignature checks the SIGNATURE item of blk is a valid signature by publicKey over the hash
+// defined by the block's HASH_DEF item. Arguments are the same as [VerifyHash].
+func VerifySignature(blk Block, blockAddr uint32, rom []byte, romAddr uint32, publicKey [PublicKeySize]byte) error {
+	sigIdx := findItem(blk.Items, ItemTypeSignature)
+	if sigIdx < 0 {
+		return errors.New("block has no signature item")
+	}
+	sigItem := Signature{Item: blk.Items[sigIdx]}
+	if sigItem.SignatureType() != SignatureTypeSecp256k1 || len(sigItem.Data) != PublicKeySize+SigSize {
+		return fmt.Errorf("unsupported signature item %s", sigItem.String())
+	} else if sigItem.PublicKey() != publicKey {
+		return errors.New("signature public key does not match")
+	}
+	pub, err := keyToPoint(publicKey)
+	if err != nil {
+		return err
+	}
+	digest, err := blockHash(blk.Items, blockAddr, rom, romAddr)
+	if err != nil {
+		return err
+	}
+	sig := sigItem.Sig()
+	r, s := getLE256(sig[:32]), getLE256(sig[32:])
+	if !secp256k1.Verify(pub, digest[:], r, s) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func pointToKey(p secp256k1.Point) (key [PublicKeySize]byte) {
+	putLE256(key[:32], p.X)
+	putLE256(key[32:], p.Y)
+	return key
+}
+
+func keyToPoint(key [PublicKeySize]byte) (secp256k1.Point, error) {
+	p := secp256k1.Point{X: getLE256(key[:32]), Y: getLE256(key[32:])}
+	if !p.IsOnCurve() {
+		return p, errors.New("public key not on secp256k1 curve")
+	}
+	return p, nil
+}
+
+// uncompressed returns the SEC 1 uncompressed encoding of p.
+func uncompressed(p secp256k1.Point) []byte {
+	var buf [65]byte
+	buf[0] = 4
+	p.X.FillBytes(buf[1:33])
+	p.Y.FillBytes(buf[33:])
+	return buf[:]
+}
+
+func putLE256(dst []byte, v *big.Int) {
+	v.FillBytes(dst[:32])
+	reverse(dst[:32])
+}
+
+func getLE256(src []byte) *big.Int {
+	var buf [32]byte
+	copy(buf[:], src)
+	reverse(buf[:])
+	return new(big.Int).SetBytes(buf[:])
+}
+
+func reverse(b []byte) {
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+}
@@ -0,0 +1,96 @@
+package picobin
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// maxReadBlockSize is the largest block [ReadBlockAt] reads, which bounds the memory used to read a corrupt block
+// whose item sizes are garbage. The bootrom's block buffers are much smaller than a flash sector.
+const maxReadBlockSize = FlashSectorSize
+
+// ReadBlockAt decodes the block whose start marker is at address addr of r, which is addressed with absolute addresses,
+// such as a UF2 or ELF ROM reader or a flash dump. Unlike [DecodeBlock] only the block's bytes are read:
+// item headers are read one at a time to learn the size of each item until the LAST item, link and end marker are read.
+// Blocks larger than a flash sector are rejected before being read.
+// As with [DecodeBlock] the block is not validated after being decoded.
+func ReadBlockAt(r io.ReaderAt, addr int64) (Block, error) {
+	text := make([]byte, 4, 64)
+	err := readFullAt(r, text, addr)
+	if err != nil {
+		return Block{}, err
+	} else if binary.LittleEndian.Uint32(text) != BlockMarkerStart {
+		return Block{}, errors.New("not start of block, missing start marker")
+	}
+	for {
+		off := len(text)
+		text = append(text, 0, 0, 0, 0)
+		err = readFullAt(r, text[off:], addr+int64(off))
+		if err != nil {
+			return Block{}, fmt.Errorf("reading item header at %#x: %w", addr+int64(off), err)
+		}
+		item := Item{Head: text[off], SizeAndSpecial: binary.LittleEndian.Uint16(text[off+1:]), TypeData: text[off+3]}
+		size := item.Size()
+		last := item.ItemType() == ItemTypeLast
+		if last {
+			size = 4 + 4 + 4 // Last item header, link and end marker.
+		} else if size < 4 {
+			return Block{}, fmt.Errorf("item %s size %d subword size", item.ItemType().String(), size)
+		} else if off+size > maxReadBlockSize {
+			return Block{}, fmt.Errorf("block at %#x exceeds max size %d", addr, maxReadBlockSize)
+		}
+		text = append(text, make([]byte, size-4)...)
+		err = readFullAt(r, text[off+4:], addr+int64(off)+4)
+		if err != nil {
+			return Block{}, fmt.Errorf("reading item %s at %#x: %w", item.ItemType().String(), addr+int64(off), err)
+		}
+		if last {
+			break
+		}
+	}
+	block, _, err := DecodeBlock(text)
+	return block, err
+}
+
+// ReadBlockLoopAt decodes the block loop whose first block starts at offset start relative to romAddr by following block
+// links and reading only the blocks' bytes from r, which is addressed with absolute addresses. See [ReadBlockAt].
+// Block offsets are relative to romAddr, as if the loop were decoded with [DecodeBlockLoop] from the ROM starting at romAddr.
+func ReadBlockLoopAt(r io.ReaderAt, romAddr int64, start int) (BlockLoop, error) {
+	return decodeBlockLoop(start, func(off int) (Block, error) {
+		return ReadBlockAt(r, romAddr+int64(off))
+	})
+}
+
+// ScanBlocksAt is like [ScanBlocks] for the ROM starting at romAddr of r, which is addressed with absolute addresses.
+// Only the search window and the blocks of candidate block loops are read from r.
+func ScanBlocksAt(r io.ReaderAt, romAddr int64) ([]BlockCandidate, error) {
+	window := make([]byte, FlashSectorSize)
+	n, err := r.ReadAt(window, romAddr)
+	if n == 0 && err != nil {
+		return nil, err
+	}
+	return scanBlocks(window[:n], func(off int) (BlockLoop, error) { return ReadBlockLoopAt(r, romAddr, off) }), nil
+}
+
+// FirstBlockIdxAt is like [FirstBlockIdx] for the ROM starting at romAddr of r, which is addressed with absolute addresses.
+func FirstBlockIdxAt(r io.ReaderAt, romAddr int64) (int, error) {
+	cands, err := ScanBlocksAt(r, romAddr)
+	if err != nil {
+		return -1, err
+	}
+	return firstCandidate(cands)
+}
+
+// readFullAt reads len(b) bytes at off or fails. Short reads without error, as returned by readers
+// of sparse data such as UF2 files, are reported as [io.ErrUnexpectedEOF].
+func readFullAt(r io.ReaderAt, b []byte, off int64) error {
+	n, err := r.ReadAt(b, off)
+	if n == len(b) {
+		return nil
+	} else if err == nil || err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
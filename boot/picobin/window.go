@@ -0,0 +1,209 @@
+package picobin
+
+import (
+	"errors"
+	"fmt"
+)
+
+// XIPBase is the start address of the RP2350 flash execute-in-place window.
+const XIPBase = 0x10000000
+
+// FlashWindow is the flash address translation (ATRANS) the bootrom sets up when booting an image
+// stored in a partition: the byte at PartitionStart+off in flash is seen at runtime address XIPBase+Delta+off.
+// The zero value is the identity translation used for images not in a partition.
+type FlashWindow struct {
+	// PartitionStart is the offset in flash of the start of the partition containing the image.
+	PartitionStart uint32
+	// Delta is the rolling window delta of the image. See [RollingWindowDelta].
+	Delta int32
+}
+
+// RuntimeAddr returns the runtime address at which the byte at flashOff in flash is seen.
+func (w FlashWindow) RuntimeAddr(flashOff uint32) uint32 {
+	return XIPBase + uint32(w.Delta) + flashOff - w.PartitionStart
+}
+
+// FlashOffset returns the offset in flash of the byte seen at runtime address addr. It fails if addr
+// is translated to an offset before the start of the partition.
+func (w FlashWindow) FlashOffset(addr uint32) (uint32, error) {
+	off := int64(addr) - XIPBase - int64(w.Delta)
+	if off < 0 {
+		return 0, fmt.Errorf("runtime address %#x before partition start", addr)
+	}
+	return w.PartitionStart + uint32(off), nil
+}
+
+// LoopFlashWindow returns the flash window of the image in loop, which was decoded from the partition
+// starting at partitionStart in flash. The delta is read from the ROLLING_WINDOW_DELTA item of the last
+// block containing an IMAGE_DEF and is zero if the block has none.
+func LoopFlashWindow(loop BlockLoop, partitionStart uint32) (FlashWindow, error) {
+	w := FlashWindow{PartitionStart: partitionStart}
+	if partitionStart%FlashSectorSize != 0 {
+		return w, errors.New("partition start not sector aligned")
+	}
+	idx := imageDefBlock(loop)
+	if idx < 0 {
+		return w, nil
+	}
+	items := loop.Blocks[idx].Items
+	if rwdIdx := findItem(items, ItemTypeRollingWindowDelta); rwdIdx >= 0 {
+		rwd := RollingWindowDelta{Item: items[rwdIdx]}
+		if len(rwd.Data) != 4 {
+			return w, errors.New("malformed rolling window delta item")
+		}
+		w.Delta = rwd.Delta()
+		if w.Delta%FlashSectorSize != 0 {
+			return w, fmt.Errorf("rolling window delta %#x not a multiple of %d", w.Delta, FlashSectorSize)
+		}
+	}
+	return w, nil
+}
+
+// EffectiveBlock is a block of a block loop with its addresses resolved through a [FlashWindow].
+type EffectiveBlock struct {
+	// Block is the index of the block in the loop.
+	Block int
+	// FlashOffset is the offset of the block in flash.
+	FlashOffset uint32
+	// RuntimeAddr is the address the block is seen at during runtime.
+	RuntimeAddr uint32
+	// LoadMap contains the block's load map entries, if any.
+	LoadMap []EffectiveLoadMapEntry
+}
+
+// EffectiveLoadMapEntry is a load map entry with its addresses resolved through a [FlashWindow].
+type EffectiveLoadMapEntry struct {
+	// StorageAddr is the runtime address of the data copied, as stored in an absolute load map.
+	StorageAddr uint32
+	// StorageFlashOffset is the offset in flash of the data copied. It is only valid if InFlash is true.
+	StorageFlashOffset uint32
+	// InFlash is true if the data copied is stored in flash, i.e: StorageAddr is in the flash window after the partition start.
+	InFlash bool
+	// RuntimeAddr is the address the data is copied to.
+	RuntimeAddr uint32
+	// Size is the number of bytes copied.
+	Size uint32
+}
+
+// EffectiveAddrs resolves the flash offsets and runtime addresses of all blocks and load map entries of loop, which was
+// decoded from the partition starting at w.PartitionStart, i.e: block offsets are relative to the partition start.
+func EffectiveAddrs(loop BlockLoop, w FlashWindow) ([]EffectiveBlock, error) {
+	blocks := make([]EffectiveBlock, len(loop.Blocks))
+	for i, lb := range loop.Blocks {
+		flashOff := w.PartitionStart + uint32(lb.Offset)
+		eb := EffectiveBlock{Block: i, FlashOffset: flashOff, RuntimeAddr: w.RuntimeAddr(flashOff)}
+		lmIdx := findItem(lb.Items, ItemTypeRollingLoadMap)
+		if lmIdx >= 0 {
+			entries, err := LoadMap{Item: lb.Items[lmIdx]}.AbsoluteEntries(itemAddr(lb.Items, lmIdx, eb.RuntimeAddr))
+			if err != nil {
+				return blocks, fmt.Errorf("block %d load map: %w", i, err)
+			}
+			for _, e := range entries {
+				ee := EffectiveLoadMapEntry{
+					StorageAddr: e.StorageStartAbsOrRel,
+					RuntimeAddr: e.RuntimeStartAbs,
+					Size:        e.SizeOrEndAbs - e.StorageStartAbsOrRel,
+				}
+				ee.StorageFlashOffset, err = w.FlashOffset(ee.StorageAddr)
+				ee.InFlash = err == nil && ee.StorageAddr >= XIPBase && ee.StorageAddr < XIPBase+maxFlashSize
+				eb.LoadMap = append(eb.LoadMap, ee)
+			}
+		}
+		blocks[i] = eb
+	}
+	return blocks, nil
+}
+
+// maxFlashSize is the size of the flash XIP window, 32MB for the 2 chip selects of the RP2350.
+const maxFlashSize = 32 << 20
+
+// RequiredDelta returns the rolling window delta an image linked to start at runtime address linkAddr
+// needs to run when stored imageOff bytes after the start of its partition. Since the delta is relative to
+// the partition start the same image runs in any partition, such as the A or B slot of an A/B partition pair.
+func RequiredDelta(linkAddr, imageOff uint32) (int32, error) {
+	delta := int64(linkAddr) - XIPBase - int64(imageOff)
+	if delta%FlashSectorSize != 0 {
+		return 0, fmt.Errorf("rolling window delta %#x not a multiple of %d", delta, FlashSectorSize)
+	} else if delta < -maxFlashSize || delta > maxFlashSize {
+		return 0, fmt.Errorf("rolling window delta %#x out of flash window", delta)
+	}
+	return int32(delta), nil
+}
+
+// Rebase sets the rolling window delta of the image stored in rom, which is linked to start at runtime address
+// romAddr, by replacing or adding a ROLLING_WINDOW_DELTA item in the last block of the loop containing an IMAGE_DEF.
+// See [RequiredDelta]. If the block is hashed the hash is recomputed and if it is signed signer
+// must be provided to sign it again. Adding an item grows the block, which is only possible if the block
+// is at the end of rom, which is the case for images created with [Seal]. rom is not modified.
+func Rebase(rom []byte, romAddr uint32, delta int32, signer Signer) ([]byte, error) {
+	if delta%FlashSectorSize != 0 {
+		return nil, fmt.Errorf("rolling window delta %#x not a multiple of %d", delta, FlashSectorSize)
+	}
+	block0Off, err := FirstBlockIdx(rom)
+	if err != nil {
+		return nil, err
+	}
+	loop, err := DecodeBlockLoop(rom, block0Off)
+	if err != nil {
+		return nil, err
+	}
+	idx := imageDefBlock(loop)
+	if idx < 0 {
+		return nil, errors.New("no IMAGE_DEF in block loop")
+	}
+	lb := loop.Blocks[idx]
+	var items []Item
+	var hashed, signed bool
+	rwd := MakeRollingWindowDelta(delta).Item
+	for _, item := range lb.Items {
+		switch item.ItemType() {
+		case ItemTypeRollingWindowDelta:
+			continue // Added after IMAGE_DEF.
+		case ItemTypeHashDef, ItemTypeHashValue:
+			hashed = true
+			continue
+		case ItemTypeSignature:
+			signed = true
+			continue
+		}
+		items = append(items, item)
+		if item.ItemType() == ItemTypeImageDef {
+			items = append(items, rwd)
+		}
+	}
+	if signed && signer == nil {
+		return nil, errors.New("image is signed, signer required to rebase")
+	}
+	rebased := append([]byte{}, rom...)
+	blockAddr := romAddr + uint32(lb.Offset)
+	switch {
+	case signed:
+		items, err = AppendSignatureItems(items, blockAddr, rebased, romAddr, signer)
+	case hashed:
+		items, err = AppendHashItems(items, blockAddr, rebased, romAddr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	newBlock := Block{Items: items, Link: lb.Link}
+	err = newBlock.Validate()
+	if err != nil {
+		return nil, err
+	}
+	if lb.Offset+newBlock.Size() <= lb.End() {
+		// Clear old block so no stale end marker is left if the block shrunk.
+		for i := lb.Offset; i < lb.End(); i++ {
+			rebased[i] = 0
+		}
+		newBlock.AppendTo(rebased[lb.Offset:lb.Offset])
+		return rebased, nil
+	} else if lb.End() != len(rom) {
+		return nil, errors.New("no room to grow block with ROLLING_WINDOW_DELTA item, seal image with the item instead")
+	}
+	return newBlock.AppendTo(rebased[:lb.Offset]), nil
+}
+
+// imageDefBlock returns the index of the last block of loop containing an IMAGE_DEF or -1.
+func imageDefBlock(loop BlockLoop) int {
+	return lastIndex(loop.Blocks, func(i int) bool { return findItem(loop.Blocks[i].Items, ItemTypeImageDef) >= 0 })
+}
@@ -0,0 +1,193 @@
+// Package rp2040boot2 implements detection, validation and replacement of the RP2040 second stage
+// bootloader, boot2. RP2040 images do not use picobin blocks. Instead the RP2040 bootrom copies the first
+// 256 bytes of flash to SRAM, checks the CRC32 stored in the last 4 bytes and jumps to it. boot2
+// configures the flash interface (SSI) for execute-in-place (XIP) for the specific flash chip used.
+package rp2040boot2
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	// Size is the size of boot2 in bytes including the trailing CRC.
+	Size = 256
+	// CodeSize is the size of boot2 code, which is followed by the CRC.
+	CodeSize = Size - 4
+	// FlashAddr is the address boot2 is stored at, the start of flash.
+	FlashAddr = 0x10000000
+)
+
+// Boot2 is the second stage bootloader as stored at the start of RP2040 flash.
+type Boot2 [Size]byte
+
+// Make creates a boot2 from code, which is padded with zeros to [CodeSize], and appends the CRC.
+// If code is [Size] bytes long its trailing CRC is ignored and replaced with the correct one.
+func Make(code []byte) (Boot2, error) {
+	var b Boot2
+	if len(code) == Size {
+		code = code[:CodeSize]
+	} else if len(code) > CodeSize {
+		return b, fmt.Errorf("boot2 code length %d exceeds %d", len(code), CodeSize)
+	}
+	copy(b[:], code)
+	b.FixCRC()
+	return b, nil
+}
+
+// Extract returns the boot2 at the start of rom, which starts at [FlashAddr]. The CRC is not checked, call [Boot2.Validate].
+func Extract(rom []byte) (Boot2, error) {
+	var b Boot2
+	if len(rom) < Size {
+		return b, fmt.Errorf("ROM length %d shorter than boot2", len(rom))
+	}
+	copy(b[:], rom)
+	return b, nil
+}
+
+// Detect returns true if rom starts with a boot2 with a valid CRC, which is the case for RP2040 images.
+func Detect(rom []byte) bool {
+	b, err := Extract(rom)
+	return err == nil && b.Validate() == nil
+}
+
+// Replace replaces the boot2 at the start of rom with b after fixing its CRC.
+func Replace(rom []byte, b Boot2) error {
+	if len(rom) < Size {
+		return fmt.Errorf("ROM length %d shorter than boot2", len(rom))
+	}
+	b.FixCRC()
+	copy(rom, b[:])
+	return nil
+}
+
+// Code returns the boot2 code without the CRC.
+func (b *Boot2) Code() []byte { return b[:CodeSize] }
+
+// StoredCRC returns the CRC stored in the last 4 bytes of boot2.
+func (b *Boot2) StoredCRC() uint32 { return binary.LittleEndian.Uint32(b[CodeSize:]) }
+
+// FixCRC stores the CRC of the boot2 code in its last 4 bytes.
+func (b *Boot2) FixCRC() { binary.LittleEndian.PutUint32(b[CodeSize:], CRC(b.Code())) }
+
+// Validate checks the stored CRC matches the CRC of the boot2 code as the RP2040 bootrom does.
+func (b *Boot2) Validate() error {
+	stored, got := b.StoredCRC(), CRC(b.Code())
+	if stored != got {
+		return fmt.Errorf("boot2 CRC mismatch: stored %#08x, calculated %#08x", stored, got)
+	}
+	return nil
+}
+
+// Identify returns the variant of boot2. See [Variant].
+func (b *Boot2) Identify() Variant {
+	if b.Validate() != nil {
+		return VariantUnknown
+	}
+	var ctrlr0, spiCtrlr0 []uint32
+	code := b.Code()
+	// Literal pool words are word aligned.
+	for i := 0; i+4 <= len(code); i += 4 {
+		w := binary.LittleEndian.Uint32(code[i:])
+		switch {
+		case w&^ssiFRFMask == ssiCtrlr0XIP:
+			ctrlr0 = append(ctrlr0, w)
+		case w&0x00ffffff == spiCtrlr0QuadXIP || w == spiCtrlr0StdXIP:
+			spiCtrlr0 = append(spiCtrlr0, w)
+		}
+	}
+	for _, c := range ctrlr0 {
+		switch c & ssiFRFMask {
+		case ssiFRFStd:
+			for _, s := range spiCtrlr0 {
+				if s == spiCtrlr0StdXIP {
+					return VariantGeneric03h
+				}
+			}
+		case ssiFRFDual:
+			return VariantW25X10CL
+		case ssiFRFQuad:
+			for _, s := range spiCtrlr0 {
+				switch s >> 24 {
+				case 0xa0:
+					return VariantW25Q080
+				case 0x20:
+					return VariantAT25SF128A
+				}
+			}
+		}
+	}
+	return VariantUnknown
+}
+
+// SSI register values boot2 variants load from their literal pool to configure XIP.
+const (
+	// CTRLR0 with 32 bit data frames and EEPROM read transfer mode. Bits 21..22 hold the SPI frame format.
+	ssiCtrlr0XIP = 31<<16 | 3<<8
+	ssiFRFMask   = 3 << 21
+	ssiFRFStd    = 0 << 21
+	ssiFRFDual   = 1 << 21
+	ssiFRFQuad   = 2 << 21
+	// SPI_CTRLR0 for 03h read command with 8 bit instruction and 24 bit address sent in standard SPI.
+	spiCtrlr0StdXIP = 0x03<<24 | 6<<2 | 2<<8
+	// SPI_CTRLR0 for continuous read mode with no instruction, 32 bit address+mode and 4 wait cycles sent in quad SPI.
+	// The mode bits are stored in bits 24..31.
+	spiCtrlr0QuadXIP = 8<<2 | 4<<11 | 2
+)
+
+// Variant is a boot2 variant of the Raspberry Pi Pico SDK, named after the flash chip it supports.
+type Variant uint8
+
+// Variants are identified by the SSI configuration they use for XIP since exact binaries
+// depend on the toolchain used to build them. Flash chips configured identically are reported
+// as the same variant, i.e: IS25LP080 boot2 is reported as [VariantW25Q080].
+const (
+	VariantUnknown    Variant = iota // unknown
+	VariantGeneric03h                // generic_03h
+	VariantW25Q080                   // w25q080
+	VariantAT25SF128A                // at25sf128a
+	VariantW25X10CL                  // w25x10cl
+)
+
+var variantNames = [...]string{
+	VariantUnknown:    "unknown",
+	VariantGeneric03h: "generic_03h",
+	VariantW25Q080:    "w25q080",
+	VariantAT25SF128A: "at25sf128a",
+	VariantW25X10CL:   "w25x10cl",
+}
+
+func (v Variant) String() string {
+	if int(v) >= len(variantNames) {
+		return fmt.Sprintf("Variant(%d)", uint8(v))
+	}
+	return variantNames[v]
+}
+
+// crcTable is the table for the CRC-32/MPEG-2 algorithm used by the RP2040 bootrom.
+var crcTable = makeCRCTable(0x04c11db7)
+
+// CRC returns the CRC-32/MPEG-2 checksum of data as calculated by the RP2040 bootrom: polynomial 0x04c11db7,
+// initial value 0xffffffff, no input or output reflection and no final XOR.
+func CRC(data []byte) uint32 {
+	crc := uint32(0xffffffff)
+	for _, b := range data {
+		crc = crc<<8 ^ crcTable[byte(crc>>24)^b]
+	}
+	return crc
+}
+
+func makeCRCTable(poly uint32) (table [256]uint32) {
+	for i := range table {
+		crc := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if crc&(1<<31) != 0 {
+				crc = crc<<1 ^ poly
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}
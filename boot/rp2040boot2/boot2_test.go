@@ -0,0 +1,109 @@
+package rp2040boot2
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+func TestCRC(t *testing.T) {
+	// CRC-32/MPEG-2 check value.
+	got := CRC([]byte("123456789"))
+	if got != 0x0376e6e7 {
+		t.Errorf("got CRC %#08x, want 0x0376e6e7", got)
+	}
+}
+
+func TestBoot2PicoSDK(t *testing.T) {
+	// boot2_w25q080 as built by the Raspberry Pi Pico SDK, the default boot2 of the Pico board.
+	rom, err := os.ReadFile("../../testdata/boot2_w25q080.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rom = append(rom, make([]byte, 1024)...)
+	if !Detect(rom) {
+		t.Fatal("pico-sdk boot2 not detected")
+	}
+	b, err := Extract(rom)
+	if err != nil {
+		t.Fatal(err)
+	} else if b.StoredCRC() != 0x7a4eb274 {
+		t.Errorf("got stored CRC %#08x, want 0x7a4eb274", b.StoredCRC())
+	} else if err = b.Validate(); err != nil {
+		t.Error(err)
+	}
+	if got := b.Identify(); got != VariantW25Q080 {
+		t.Errorf("want variant %s, got %s", VariantW25Q080, got)
+	}
+}
+
+func TestBoot2(t *testing.T) {
+	// Fake boot2 code with literal pools of each variant's SSI configuration.
+	variantLiterals := map[Variant][]uint32{
+		VariantGeneric03h: {0x18000000, 0x001f0300, 0x03000218},
+		VariantW25Q080:    {0x18000000, 0x005f0300, 0x00002221, 0xa0002022},
+		VariantAT25SF128A: {0x18000000, 0x005f0300, 0x00002221, 0x20002022},
+		VariantW25X10CL:   {0x18000000, 0x003f0300},
+		VariantUnknown:    {0x18000000, 0x40020000},
+	}
+	for want, literals := range variantLiterals {
+		code := make([]byte, 0xc0) // Instructions.
+		for i := range code {
+			code[i] = byte(i)
+		}
+		for _, lit := range literals {
+			code = binary.LittleEndian.AppendUint32(code, lit)
+		}
+		b, err := Make(code)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = b.Validate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := b.Identify()
+		if got != want {
+			t.Errorf("want variant %s, got %s", want, got)
+		}
+	}
+
+	rom := make([]byte, 1024)
+	if Detect(rom) {
+		t.Error("detected boot2 in empty ROM")
+	}
+	b, err := Make([]byte{0x00, 0xb5, 0x32, 0x4b})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Replace(rom, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Detect(rom) {
+		t.Fatal("boot2 not detected after replace")
+	}
+	got, err := Extract(rom)
+	if err != nil {
+		t.Fatal(err)
+	} else if got != b {
+		t.Error("extracted boot2 does not match replaced boot2")
+	}
+	rom[10] ^= 1
+	got, _ = Extract(rom)
+	if got.Validate() == nil {
+		t.Error("expected CRC mismatch after corrupting boot2")
+	}
+	// Replacing with a boot2 with bad CRC fixes CRC.
+	got[0] ^= 1
+	err = Replace(rom, got)
+	if err != nil {
+		t.Fatal(err)
+	} else if !Detect(rom) {
+		t.Error("expected replace to fix CRC")
+	}
+	_, err = Make(make([]byte, CodeSize+1))
+	if err == nil {
+		t.Error("expected error making boot2 with too long code")
+	}
+}
@@ -0,0 +1,246 @@
+package rp2350otp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MarshalJSON encodes the programmed rows of the OTP in the JSON format picotool loads with "picotool otp load".
+// The result is an object keyed by lower case register name or row number:
+//   - Registers with fields are objects of their non-zero fields, i.e: {"crit1": {"secure_boot_enable": 1}}.
+//   - Multi-row registers are byte arrays, i.e: {"bootkey0": [137, 12, ...]}.
+//   - Other registers are numbers.
+//   - Rows outside registers, or registers whose rows are not consistently programmed, are encoded
+//     as raw rows, i.e: {"0x0c0": {"ecc": false, "value": 1193046}}.
+func (o *OTP) MarshalJSON() ([]byte, error) {
+	m := make(map[string]any)
+	var covered [NumRows]bool
+	for _, r := range Registers {
+		if !o.canonical(r) {
+			continue // Encoded as raw rows.
+		}
+		programmed := false
+		for _, row := range r.rows() {
+			covered[row] = true
+			programmed = programmed || o.rows[row] != 0
+		}
+		if !programmed {
+			continue
+		}
+		name := strings.ToLower(r.Name)
+		if r.Rows > 1 {
+			b, err := o.Bytes(r)
+			if err != nil {
+				return nil, err
+			}
+			ints := make([]int, len(b)) // Avoid base64 encoding of []byte.
+			for i := range b {
+				ints[i] = int(b[i])
+			}
+			m[name] = ints
+			continue
+		}
+		v, err := o.Get(r)
+		if err != nil {
+			return nil, err
+		}
+		m[name] = v
+		var fieldMask uint32
+		fields := make(map[string]uint32)
+		for _, f := range r.Fields {
+			fieldMask |= f.Mask()
+			if fv := v & f.Mask() >> f.Shift; fv != 0 {
+				fields[strings.ToLower(f.Name)] = fv
+			}
+		}
+		if len(r.Fields) > 0 && v&^fieldMask == 0 {
+			m[name] = fields
+		}
+	}
+	for row, raw := range o.rows {
+		if !covered[row] && raw != 0 {
+			m[fmt.Sprintf("0x%03x", row)] = rawRow{ECC: false, Value: raw}
+		}
+	}
+	return json.Marshal(m)
+}
+
+type rawRow struct {
+	ECC   bool   `json:"ecc"`
+	Value uint32 `json:"value"`
+}
+
+// canonical returns true if the register's rows hold exactly what [OTP.Set] or [OTP.SetBytes] would write,
+// so the register can be encoded by value without losing information.
+func (o *OTP) canonical(r Register) bool {
+	rows := r.rows()
+	for _, row := range rows {
+		raw := o.rows[row]
+		switch {
+		case r.ECC && ECC(uint16(raw)) != raw:
+			return false
+		case !r.ECC && raw != o.rows[rows[0]]:
+			return false
+		}
+	}
+	return true
+}
+
+// UnmarshalJSON programs the OTP with the rows in the JSON format picotool loads with "picotool otp load".
+// Rows already programmed are kept, as when loading into a device. Keys are register names, compared case
+// insensitively, or row numbers in decimal or 0x prefixed hexadecimal. Values are one of:
+//   - A number, written to a register or to a row as a raw 24 bit value.
+//   - An array of bytes, written to the ECC protected rows of a register or starting at a row.
+//   - An object of field names to numbers, written to the fields of a register.
+//   - An object {"ecc": bool, "value": number or array of bytes} written to a row with or without ECC.
+//
+// Numbers may also be given as strings, i.e: "0x1234".
+func (o *OTP) UnmarshalJSON(b []byte) error {
+	var m map[string]json.RawMessage
+	err := json.Unmarshal(b, &m)
+	if err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		err = o.loadJSON(k, m[k])
+		if err != nil {
+			return fmt.Errorf("OTP JSON %q: %w", k, err)
+		}
+	}
+	return nil
+}
+
+func (o *OTP) loadJSON(key string, raw json.RawMessage) error {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	err := dec.Decode(&v)
+	if err != nil {
+		return err
+	}
+	if r, ok := LookupRegister(key); ok {
+		return o.loadRegister(r, v)
+	}
+	row, err := strconv.ParseUint(key, 0, 16)
+	if err != nil || row >= NumRows {
+		return errors.New("unknown register or row")
+	}
+	return o.loadRow(int(row), v)
+}
+
+func (o *OTP) loadRegister(r Register, v any) error {
+	switch v := v.(type) {
+	case []any:
+		b, err := jsonBytes(v)
+		if err != nil {
+			return err
+		}
+		return o.SetBytes(r, b)
+	case map[string]any:
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fv, err := jsonUint(v[name])
+			if err != nil {
+				return fmt.Errorf("field %s: %w", name, err)
+			}
+			err = o.SetField(r, name, fv)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	value, err := jsonUint(v)
+	if err != nil {
+		return err
+	}
+	return o.Set(r, value)
+}
+
+func (o *OTP) loadRow(row int, v any) error {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		if arr, ok := v.([]any); ok {
+			b, err := jsonBytes(arr)
+			if err != nil {
+				return err
+			}
+			return o.WriteECCBytes(row, b)
+		}
+		value, err := jsonUint(v)
+		if err != nil {
+			return err
+		}
+		return o.WriteRaw(row, value)
+	}
+	ecc, ok := obj["ecc"].(bool)
+	if !ok && obj["ecc"] != nil {
+		return errors.New("ecc must be a boolean")
+	}
+	switch value := obj["value"].(type) {
+	case []any:
+		if !ecc {
+			return errors.New("byte arrays can only be written with ecc")
+		}
+		b, err := jsonBytes(value)
+		if err != nil {
+			return err
+		}
+		return o.WriteECCBytes(row, b)
+	default:
+		n, err := jsonUint(value)
+		if err != nil {
+			return err
+		} else if !ecc {
+			return o.WriteRaw(row, n)
+		} else if n > 0xffff {
+			return fmt.Errorf("ECC row value %#x exceeds 16 bits", n)
+		}
+		return o.WriteECC(row, uint16(n))
+	}
+}
+
+// jsonUint parses a JSON number, or a string holding a number in Go syntax, as a 32 bit unsigned integer.
+func jsonUint(v any) (uint32, error) {
+	var s string
+	base := 10
+	switch v := v.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+		base = 0
+	default:
+		return 0, fmt.Errorf("expected number, got %T", v)
+	}
+	n, err := strconv.ParseUint(s, base, 32)
+	return uint32(n), err
+}
+
+func jsonBytes(arr []any) ([]byte, error) {
+	b := make([]byte, len(arr))
+	for i, v := range arr {
+		n, err := jsonUint(v)
+		if err != nil {
+			return nil, err
+		} else if n > 0xff {
+			return nil, fmt.Errorf("byte %d value %#x exceeds 8 bits", i, n)
+		}
+		b[i] = byte(n)
+	}
+	return b, nil
+}
@@ -0,0 +1,490 @@
+// Package rp2350otp models the RP2350 one-time-programmable (OTP) memory: raw and ECC protected rows,
+// the named rows and fields the bootrom reads to make secure boot and rollback decisions and the JSON
+// format picotool uses to load OTP contents.
+package rp2350otp
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/bits"
+	"strings"
+
+	"github.com/soypat/tinyboot/boot/picobin"
+)
+
+const (
+	// NumRows is the number of rows in OTP.
+	NumRows = 4096
+	// RowMask is the mask of the 24 bits stored in a raw row.
+	RowMask = 1<<24 - 1
+	// eccMask is the mask of the data and ECC bits of an ECC row.
+	eccMask = 1<<22 - 1
+	// brbpBits are the bit repair by polarity flags of an ECC row.
+	brbpBits = 3 << 22
+	// NumBootKeys is the number of boot key slots in OTP.
+	NumBootKeys = 4
+	// BootKeyRows is the number of ECC rows storing a boot key hash.
+	BootKeyRows = sha256.Size / 2
+)
+
+// eccMasks are the data bits covered by each Hamming parity bit. Data bits are placed at the codeword
+// positions which are not a power of two, parity bit i covers positions with bit i set.
+var eccMasks = [5]uint32{0xad5b, 0x366d, 0xc78e, 0x07f0, 0xf800}
+
+// ECC returns the raw row value storing data with ECC: data in bits 0..15 followed by 5 Hamming parity bits and an
+// overall parity bit in bits 16..21, which allow correcting single bit errors and detecting double bit errors.
+// The bit repair by polarity (BRBP) flags in bits 22..23 are left unset.
+func ECC(data uint16) uint32 {
+	var p uint32
+	for i, mask := range eccMasks {
+		p |= parity(uint32(data)&mask) << i
+	}
+	p |= parity(uint32(data)|p<<16) << 5
+	return uint32(data) | p<<16
+}
+
+// DecodeECC returns the data stored in the raw ECC row value raw as read by the hardware. If both BRBP flags are set
+// the data and ECC bits are inverted before decoding, which permits rewriting a row with a stuck bit inverted.
+// Single bit errors are corrected, in which case corrected is true, and double bit errors return an error.
+func DecodeECC(raw uint32) (data uint16, corrected bool, err error) {
+	if raw&brbpBits == brbpBits {
+		raw = ^raw
+	}
+	raw &= eccMask
+	data = uint16(raw)
+	syndrome := (ECC(data) ^ raw) >> 16 & 0x1f
+	odd := parity(raw) != 0
+	switch {
+	case !odd && syndrome == 0:
+		return data, false, nil
+	case !odd:
+		return data, false, errors.New("uncorrectable ECC error")
+	case syndrome&(syndrome-1) == 0:
+		return data, true, nil // Error in a parity bit.
+	}
+	bit := eccDataBit(syndrome)
+	if bit < 0 {
+		return data, false, errors.New("uncorrectable ECC error")
+	}
+	return data ^ 1<<bit, true, nil
+}
+
+// eccDataBit returns the data bit stored at codeword position pos or -1.
+func eccDataBit(pos uint32) int {
+	bit := 0
+	for p := uint32(3); p <= 21; p++ {
+		if p&(p-1) == 0 {
+			continue // Parity bit position.
+		}
+		if p == pos {
+			return bit
+		}
+		bit++
+	}
+	return -1
+}
+
+func parity(x uint32) uint32 { return uint32(bits.OnesCount32(x) & 1) }
+
+// OTP is the contents of the RP2350 OTP as raw 24 bit rows. Unprogrammed rows read as zero and programming
+// can only set bits, so writes fail if they would need to clear a programmed bit. The zero value is an unprogrammed OTP.
+type OTP struct {
+	rows [NumRows]uint32
+}
+
+// Raw returns the raw 24 bit value of row.
+func (o *OTP) Raw(row int) (uint32, error) {
+	if row < 0 || row >= NumRows {
+		return 0, fmt.Errorf("OTP row %#x out of range", row)
+	}
+	return o.rows[row], nil
+}
+
+// WriteRaw programs row with the raw 24 bit value.
+func (o *OTP) WriteRaw(row int, value uint32) error {
+	old, err := o.Raw(row)
+	if err != nil {
+		return err
+	} else if value&^RowMask != 0 {
+		return fmt.Errorf("OTP row %#x value %#x exceeds 24 bits", row, value)
+	} else if old&^value != 0 {
+		return fmt.Errorf("OTP row %#x programmed with %#06x, can't clear bits to write %#06x", row, old, value)
+	}
+	o.rows[row] = value
+	return nil
+}
+
+// ReadECC returns the data of the ECC protected row, correcting single bit errors.
+func (o *OTP) ReadECC(row int) (uint16, error) {
+	raw, err := o.Raw(row)
+	if err != nil {
+		return 0, err
+	}
+	data, _, err := DecodeECC(raw)
+	if err != nil {
+		return 0, fmt.Errorf("OTP row %#x: %w", row, err)
+	}
+	return data, nil
+}
+
+// WriteECC programs row with data protected by ECC.
+func (o *OTP) WriteECC(row int, data uint16) error {
+	return o.WriteRaw(row, ECC(data))
+}
+
+// ReadECCBytes returns n bytes stored in consecutive ECC protected rows starting at row, 2 bytes per row in little endian order.
+func (o *OTP) ReadECCBytes(row, n int) ([]byte, error) {
+	b := make([]byte, 0, n+1)
+	for i := 0; len(b) < n; i++ {
+		data, err := o.ReadECC(row + i)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, byte(data), byte(data>>8))
+	}
+	return b[:n], nil
+}
+
+// WriteECCBytes programs b in consecutive ECC protected rows starting at row, 2 bytes per row in little endian order.
+// An odd length is padded with a zero byte.
+func (o *OTP) WriteECCBytes(row int, b []byte) error {
+	if row < 0 || row+(len(b)+1)/2 > NumRows {
+		return fmt.Errorf("%d bytes at OTP row %#x out of range", len(b), row)
+	}
+	for i := 0; i < len(b); i += 2 {
+		data := uint16(b[i])
+		if i+1 < len(b) {
+			data |= uint16(b[i+1]) << 8
+		}
+		err := o.WriteECC(row+i/2, data)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Register is a named OTP row, or group of rows, as described in the RP2350 datasheet.
+type Register struct {
+	Name string
+	// Row is the first row of the register.
+	Row int
+	// Rows is the number of consecutive ECC protected rows the register spans. Registers of more than one row,
+	// such as boot key hashes, hold bytes and are accessed with [OTP.Bytes] and [OTP.SetBytes].
+	Rows int
+	// ECC is set if rows hold 16 bits of data protected by ECC. Otherwise rows hold 24 raw bits.
+	ECC bool
+	// Copies is the number of redundant copies of a raw register stored in consecutive rows starting at Row.
+	// A bit of a redundant register is set if it is set in at least Vote copies.
+	Copies, Vote int
+	// Fields are the named bit fields of a single row register.
+	Fields []Field
+}
+
+// Field is a bit field of a [Register].
+type Field struct {
+	Name string
+	// Shift is the position of the field's least significant bit.
+	Shift uint
+	// Width is the number of bits of the field.
+	Width uint
+}
+
+// Mask returns the mask of the field's bits in its register.
+func (f Field) Mask() uint32 { return (1<<f.Width - 1) << f.Shift }
+
+// rows returns the row numbers of all rows the register occupies.
+func (r Register) rows() []int {
+	n := r.Rows
+	if r.Copies > n {
+		n = r.Copies
+	}
+	rows := make([]int, n)
+	for i := range rows {
+		rows[i] = r.Row + i
+	}
+	return rows
+}
+
+// Field returns the register's field with the name, compared case insensitively.
+func (r Register) Field(name string) (Field, bool) {
+	for _, f := range r.Fields {
+		if strings.EqualFold(f.Name, name) {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+// Registers are the OTP registers read by the bootrom during secure boot and image selection.
+var Registers = []Register{
+	{Name: "CRIT0", Row: 0x038, Copies: 8, Vote: 3, Fields: []Field{
+		{Name: "ARM_DISABLE", Shift: 0, Width: 1},
+		{Name: "RISCV_DISABLE", Shift: 1, Width: 1},
+	}},
+	{Name: "CRIT1", Row: 0x040, Copies: 8, Vote: 3, Fields: []Field{
+		{Name: "SECURE_BOOT_ENABLE", Shift: 0, Width: 1},
+		{Name: "SECURE_DEBUG_DISABLE", Shift: 1, Width: 1},
+		{Name: "DEBUG_DISABLE", Shift: 2, Width: 1},
+		{Name: "BOOT_ARCH", Shift: 3, Width: 1},
+		{Name: "GLITCH_DETECTOR_ENABLE", Shift: 4, Width: 1},
+		{Name: "GLITCH_DETECTOR_SENS", Shift: 5, Width: 2},
+	}},
+	{Name: "BOOT_FLAGS0", Row: 0x048, Copies: 3, Vote: 2, Fields: []Field{
+		{Name: "ENABLE_BOOTSCREEN", Shift: 2, Width: 1},
+		{Name: "FLASH_IO_VOLTAGE_1V8", Shift: 3, Width: 1},
+		{Name: "FAST_SIGCHECK_ROSC_DIV", Shift: 4, Width: 1},
+		{Name: "FLASH_DEVINFO_ENABLE", Shift: 5, Width: 1},
+		{Name: "OVERRIDE_FLASH_PARTITION_SLOT_SIZE", Shift: 6, Width: 1},
+		{Name: "SINGLE_FLASH_BINARY", Shift: 7, Width: 1},
+		{Name: "DISABLE_AUTO_SWITCH_ARCH", Shift: 8, Width: 1},
+		{Name: "SECURE_PARTITION_TABLE", Shift: 9, Width: 1},
+		{Name: "HASHED_PARTITION_TABLE", Shift: 10, Width: 1},
+		{Name: "ROLLBACK_REQUIRED", Shift: 11, Width: 1},
+		{Name: "DISABLE_FLASH_BOOT", Shift: 12, Width: 1},
+		{Name: "DISABLE_OTP_BOOT", Shift: 13, Width: 1},
+		{Name: "ENABLE_OTP_BOOT", Shift: 14, Width: 1},
+		{Name: "DISABLE_POWER_SCRATCH", Shift: 15, Width: 1},
+		{Name: "DISABLE_WATCHDOG_SCRATCH", Shift: 16, Width: 1},
+		{Name: "DISABLE_BOOTSEL_USB_MSD_IFC", Shift: 17, Width: 1},
+		{Name: "DISABLE_BOOTSEL_USB_PICOBOOT_IFC", Shift: 18, Width: 1},
+		{Name: "DISABLE_BOOTSEL_UART_BOOT", Shift: 19, Width: 1},
+		{Name: "DISABLE_XIP_ACCESS_ON_SRAM_ENTRY", Shift: 20, Width: 1},
+		{Name: "DISABLE_SRAM_WINDOW_BOOT", Shift: 21, Width: 1},
+	}},
+	{Name: "BOOT_FLAGS1", Row: 0x04b, Copies: 3, Vote: 2, Fields: []Field{
+		{Name: "KEY_VALID", Shift: 0, Width: NumBootKeys},
+		{Name: "KEY_INVALID", Shift: 8, Width: NumBootKeys},
+		{Name: "DOUBLE_TAP_DELAY", Shift: 16, Width: 3},
+		{Name: "DOUBLE_TAP", Shift: 19, Width: 1},
+	}},
+	{Name: "DEFAULT_BOOT_VERSION0", Row: 0x04e, Copies: 3, Vote: 2},
+	{Name: "DEFAULT_BOOT_VERSION1", Row: 0x051, Copies: 3, Vote: 2},
+	{Name: "BOOTKEY0", Row: 0x080, Rows: BootKeyRows, ECC: true},
+	{Name: "BOOTKEY1", Row: 0x090, Rows: BootKeyRows, ECC: true},
+	{Name: "BOOTKEY2", Row: 0x0a0, Rows: BootKeyRows, ECC: true},
+	{Name: "BOOTKEY3", Row: 0x0b0, Rows: BootKeyRows, ECC: true},
+}
+
+// LookupRegister returns the register in [Registers] with the name, compared case insensitively.
+func LookupRegister(name string) (Register, bool) {
+	for _, r := range Registers {
+		if strings.EqualFold(r.Name, name) {
+			return r, true
+		}
+	}
+	return Register{}, false
+}
+
+func mustRegister(name string) Register {
+	r, ok := LookupRegister(name)
+	if !ok {
+		panic("unknown OTP register " + name)
+	}
+	return r
+}
+
+var (
+	regCRIT1      = mustRegister("CRIT1")
+	regBootFlags0 = mustRegister("BOOT_FLAGS0")
+	regBootFlags1 = mustRegister("BOOT_FLAGS1")
+)
+
+// Get returns the value of a single row register. Redundant copies are combined by vote.
+func (o *OTP) Get(r Register) (uint32, error) {
+	switch {
+	case r.Rows > 1:
+		return 0, fmt.Errorf("%s spans %d rows, read its bytes", r.Name, r.Rows)
+	case r.ECC:
+		data, err := o.ReadECC(r.Row)
+		return uint32(data), err
+	case r.Copies <= 1:
+		return o.Raw(r.Row)
+	}
+	var v uint32
+	for bit := 0; bit < 24; bit++ {
+		set := 0
+		for _, row := range r.rows() {
+			raw, err := o.Raw(row)
+			if err != nil {
+				return 0, err
+			}
+			set += int(raw >> bit & 1)
+		}
+		if set >= r.Vote {
+			v |= 1 << bit
+		}
+	}
+	return v, nil
+}
+
+// Set programs a single row register with value, writing all its redundant copies. The bits of value are ORed into
+// each redundant copy so bits set in a minority of copies are kept, but value must not clear a voted bit.
+func (o *OTP) Set(r Register, value uint32) error {
+	switch {
+	case r.Rows > 1:
+		return fmt.Errorf("%s spans %d rows, write its bytes", r.Name, r.Rows)
+	case r.ECC && value > 0xffff:
+		return fmt.Errorf("%s value %#x exceeds 16 bits", r.Name, value)
+	case r.ECC:
+		return o.WriteECC(r.Row, uint16(value))
+	case r.Copies <= 1:
+		err := o.WriteRaw(r.Row, value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.Name, err)
+		}
+		return nil
+	}
+	old, err := o.Get(r)
+	if err != nil {
+		return err
+	} else if old&^value != 0 {
+		return fmt.Errorf("%s programmed with %#06x, can't clear bits to write %#06x", r.Name, old, value)
+	}
+	for _, row := range r.rows() {
+		raw, _ := o.Raw(row) // Rows checked by Get.
+		err = o.WriteRaw(row, raw|value)
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.Name, err)
+		}
+	}
+	return nil
+}
+
+// GetField returns the value of the register's field with the name.
+func (o *OTP) GetField(r Register, name string) (uint32, error) {
+	f, ok := r.Field(name)
+	if !ok {
+		return 0, fmt.Errorf("%s has no field %s", r.Name, name)
+	}
+	v, err := o.Get(r)
+	return v & f.Mask() >> f.Shift, err
+}
+
+// SetField programs the register's field with the name to value, keeping the register's other bits.
+func (o *OTP) SetField(r Register, name string, value uint32) error {
+	f, ok := r.Field(name)
+	if !ok {
+		return fmt.Errorf("%s has no field %s", r.Name, name)
+	} else if value > f.Mask()>>f.Shift {
+		return fmt.Errorf("%s.%s value %#x exceeds %d bits", r.Name, f.Name, value, f.Width)
+	}
+	v, err := o.Get(r)
+	if err != nil {
+		return err
+	}
+	return o.Set(r, v|value<<f.Shift)
+}
+
+// Bytes returns the bytes stored in the ECC protected rows of the register.
+func (o *OTP) Bytes(r Register) ([]byte, error) {
+	if !r.ECC {
+		return nil, fmt.Errorf("%s is not ECC protected", r.Name)
+	}
+	return o.ReadECCBytes(r.Row, 2*len(r.rows()))
+}
+
+// SetBytes programs the ECC protected rows of the register with b, which must fit in the register.
+func (o *OTP) SetBytes(r Register, b []byte) error {
+	if !r.ECC {
+		return fmt.Errorf("%s is not ECC protected", r.Name)
+	} else if len(b) > 2*len(r.rows()) {
+		return fmt.Errorf("%d bytes exceed %s size", len(b), r.Name)
+	}
+	return o.WriteECCBytes(r.Row, b)
+}
+
+// BootKey returns the BOOTKEYn register, which stores the hash of boot key n.
+func BootKey(n int) (Register, error) {
+	if n < 0 || n >= NumBootKeys {
+		return Register{}, fmt.Errorf("boot key %d out of range", n)
+	}
+	return mustRegister(fmt.Sprintf("BOOTKEY%d", n)), nil
+}
+
+// BootKeyData returns the data of the BOOTKEYn rows storing the hash of publicKey, the values to burn with ECC
+// for the bootrom to accept images signed with the key. See [picobin.PublicKeyHash].
+func BootKeyData(publicKey [picobin.PublicKeySize]byte) (rows [BootKeyRows]uint16) {
+	hash := picobin.PublicKeyHash(publicKey)
+	for i := range rows {
+		rows[i] = uint16(hash[2*i]) | uint16(hash[2*i+1])<<8
+	}
+	return rows
+}
+
+// SetBootKey programs the hash of publicKey in BOOTKEYn and marks it valid in BOOT_FLAGS1.KEY_VALID.
+// Secure boot is enabled separately by setting CRIT1.SECURE_BOOT_ENABLE.
+func (o *OTP) SetBootKey(n int, publicKey [picobin.PublicKeySize]byte) error {
+	r, err := BootKey(n)
+	if err != nil {
+		return err
+	}
+	for i, data := range BootKeyData(publicKey) {
+		err = o.WriteECC(r.Row+i, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.Name, err)
+		}
+	}
+	valid, err := o.GetField(regBootFlags1, "KEY_VALID")
+	if err != nil {
+		return err
+	}
+	return o.SetField(regBootFlags1, "KEY_VALID", valid|1<<n)
+}
+
+// BootKeyHashes returns the hashes of the boot keys marked valid and not marked invalid in BOOT_FLAGS1.
+func (o *OTP) BootKeyHashes() ([][sha256.Size]byte, error) {
+	flags, err := o.Get(regBootFlags1)
+	if err != nil {
+		return nil, err
+	}
+	var hashes [][sha256.Size]byte
+	for n := 0; n < NumBootKeys; n++ {
+		if flags>>n&1 == 0 || flags>>(8+n)&1 != 0 {
+			continue
+		}
+		r, _ := BootKey(n)
+		b, err := o.Bytes(r)
+		if err != nil {
+			return nil, err
+		}
+		var hash [sha256.Size]byte
+		copy(hash[:], b)
+		hashes = append(hashes, hash)
+	}
+	return hashes, nil
+}
+
+// RollbackVersion returns the thermometer coded rollback version stored in the raw OTP rows listed in an image's
+// VERSION item, 24 bits per row: the version is the position of the highest set bit plus one. See [picobin.Version.OTPRows].
+func (o *OTP) RollbackVersion(rows []uint16) (uint16, error) {
+	var version int
+	for i, row := range rows {
+		raw, err := o.Raw(int(row))
+		if err != nil {
+			return 0, err
+		} else if raw != 0 {
+			version = 24*i + bits.Len32(raw)
+		}
+	}
+	return uint16(version), nil
+}
+
+// BootConfig returns the configuration the bootrom running on cpu reads from OTP to select an image.
+// RollbackVersion is left zero since it depends on the image, see [OTP.RollbackVersion].
+func (o *OTP) BootConfig(cpu picobin.ExeCPU) (picobin.BootConfig, error) {
+	cfg := picobin.BootConfig{CPU: cpu}
+	secure, err := o.GetField(regCRIT1, "SECURE_BOOT_ENABLE")
+	if err != nil {
+		return cfg, err
+	}
+	noSwitch, err := o.GetField(regBootFlags0, "DISABLE_AUTO_SWITCH_ARCH")
+	if err != nil {
+		return cfg, err
+	}
+	cfg.SecureBoot = secure != 0
+	cfg.DisableAutoSwitchArch = noSwitch != 0
+	cfg.KeyHashes, err = o.BootKeyHashes()
+	return cfg, err
+}
@@ -0,0 +1,198 @@
+package rp2350otp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/soypat/tinyboot/boot/picobin"
+)
+
+func TestECC(t *testing.T) {
+	// Reference encoder built from the Hamming code definition instead of the parity masks: data bits take the
+	// codeword positions 1..21 which are not a power of two, parity bit i is the XOR of data positions with bit i set.
+	ref := func(data uint16) uint32 {
+		var p uint32
+		d := 0
+		for pos := 1; pos <= 21; pos++ {
+			if pos&(pos-1) == 0 {
+				continue // Parity bit position.
+			}
+			if data>>d&1 != 0 {
+				p ^= uint32(pos)
+			}
+			d++
+		}
+		raw := uint32(data) | p<<16
+		overall := uint32(0)
+		for bit := 0; bit < 21; bit++ {
+			overall ^= raw >> bit & 1
+		}
+		return raw | overall<<21
+	}
+	if got := ECC(0); got != 0 {
+		t.Errorf("ECC(0): expected 0 so erased rows read as zero, got %#06x", got)
+	}
+	// A row with both BRBP bits set is stored inverted.
+	if got, _, err := DecodeECC(0xffffff); err != nil || got != 0 {
+		t.Errorf("decode all ones row: got %#x (%v), want 0", got, err)
+	}
+	for i := 0; i <= 0xffff; i++ {
+		data := uint16(i)
+		raw := ECC(data)
+		if want := ref(data); raw != want {
+			t.Fatalf("ECC(%#04x): expected %#06x, got %#06x", data, want, raw)
+		} else if raw&^eccMask != 0 || uint16(raw) != data {
+			t.Fatalf("bad ECC encoding %#x of %#x", raw, data)
+		}
+		got, corrected, err := DecodeECC(raw)
+		if err != nil || corrected || got != data {
+			t.Fatalf("decode %#x: got %#x corrected=%v err=%v", data, got, corrected, err)
+		}
+		got, _, err = DecodeECC(^raw)
+		if err != nil || got != data {
+			t.Fatalf("decode BRBP inverted %#x: got %#x err=%v", data, got, err)
+		}
+		if i%257 != 0 {
+			continue // Test bit errors on a subset of values.
+		}
+		for bit := 0; bit < 22; bit++ {
+			got, corrected, err = DecodeECC(raw ^ 1<<bit)
+			if err != nil || !corrected || got != data {
+				t.Fatalf("decode %#x with bit %d flipped: got %#x corrected=%v err=%v", data, bit, got, corrected, err)
+			}
+			for bit2 := bit + 1; bit2 < 22; bit2++ {
+				_, _, err = DecodeECC(raw ^ 1<<bit ^ 1<<bit2)
+				if err == nil {
+					t.Fatalf("decode %#x with bits %d,%d flipped: expected error", data, bit, bit2)
+				}
+			}
+		}
+	}
+}
+
+func TestOTP(t *testing.T) {
+	var otp OTP
+	crit1, _ := LookupRegister("crit1")
+	err := otp.SetField(crit1, "secure_boot_enable", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < crit1.Copies; i++ {
+		if raw, _ := otp.Raw(crit1.Row + i); raw != 1 {
+			t.Errorf("CRIT1 copy %d: got %#x, want 1", i, raw)
+		}
+	}
+	// Clearing a copy below the vote threshold does not change the value.
+	otp.rows[crit1.Row] = 0
+	otp.rows[crit1.Row+1] = 0
+	if v, err := otp.GetField(crit1, "SECURE_BOOT_ENABLE"); err != nil || v != 1 {
+		t.Errorf("got SECURE_BOOT_ENABLE %d (%v), want 1", v, err)
+	}
+	err = otp.WriteRaw(crit1.Row+2, 0)
+	if err == nil {
+		t.Error("expected error clearing programmed bits")
+	}
+	// Bits set in a minority of copies are kept when setting other fields.
+	otp.rows[crit1.Row+3] |= 1 << 2
+	err = otp.SetField(crit1, "SECURE_DEBUG_DISABLE", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if raw, _ := otp.Raw(crit1.Row); raw != 0b011 {
+		t.Errorf("CRIT1 copy 0: got %#x, want 0b011", raw)
+	} else if raw, _ = otp.Raw(crit1.Row + 3); raw != 0b111 {
+		t.Errorf("CRIT1 copy 3: got %#x, want 0b111", raw)
+	}
+	err = otp.Set(crit1, 0b010)
+	if err == nil {
+		t.Error("expected error clearing voted bit")
+	}
+
+	var pub [picobin.PublicKeySize]byte
+	for i := range pub {
+		pub[i] = byte(i)
+	}
+	err = otp.SetBootKey(1, pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := otp.BootConfig(picobin.ExeCPUARM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !cfg.SecureBoot || len(cfg.KeyHashes) != 1 || cfg.KeyHashes[0] != picobin.PublicKeyHash(pub) {
+		t.Errorf("bad boot config %+v", cfg)
+	}
+	bootkey1, _ := BootKey(1)
+	data := BootKeyData(pub)
+	for i := range data {
+		if got, _ := otp.ReadECC(bootkey1.Row + i); got != data[i] {
+			t.Errorf("BOOTKEY1 row %d: got %#x, want %#x", i, got, data[i])
+		}
+	}
+
+	otp.rows[0x100] = 0xfffffe
+	otp.rows[0x101] = 0x3
+	rollback, err := otp.RollbackVersion([]uint16{0x100, 0x101})
+	if err != nil || rollback != 26 {
+		t.Errorf("got rollback version %d (%v), want 26", rollback, err)
+	}
+}
+
+func TestJSON(t *testing.T) {
+	// Handwritten in the format of picotool's OTP JSON files, with additional row number keys.
+	const otpJSON = `{
+	"boot_flags1": {"key_valid": 1},
+	"bootkey0": [137, 12, 5, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27, 28],
+	"crit1": {"secure_boot_enable": 1},
+	"0x0c0": {"ecc": true, "value": "0x1234"},
+	"193": 5,
+	"0xc2": [1, 2, 3]
+}`
+	var otp OTP
+	err := json.Unmarshal([]byte(otpJSON), &otp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := otp.BootConfig(picobin.ExeCPURISCV)
+	if err != nil {
+		t.Fatal(err)
+	} else if !cfg.SecureBoot || len(cfg.KeyHashes) != 1 || cfg.KeyHashes[0][0] != 137 || cfg.KeyHashes[0][31] != 28 {
+		t.Errorf("bad boot config %+v", cfg)
+	}
+	if got, _ := otp.ReadECC(0xc0); got != 0x1234 {
+		t.Errorf("got row 0xc0 %#x, want 0x1234", got)
+	}
+	if got, _ := otp.Raw(0xc1); got != 5 {
+		t.Errorf("got row 0xc1 %#x, want 5", got)
+	}
+	if got, _ := otp.ReadECCBytes(0xc2, 4); string(got) != "\x01\x02\x03\x00" {
+		t.Errorf("got rows 0xc2.. %q", got)
+	}
+
+	b, err := json.Marshal(&otp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var otp2 OTP
+	err = json.Unmarshal(b, &otp2)
+	if err != nil {
+		t.Fatal(err)
+	} else if otp2 != otp {
+		t.Errorf("JSON round trip mismatch: %s", b)
+	}
+	var m map[string]any
+	json.Unmarshal(b, &m)
+	if _, ok := m["crit1"].(map[string]any); !ok {
+		t.Errorf("expected crit1 fields in %s", b)
+	}
+
+	err = json.Unmarshal([]byte(`{"crit1": {"not_a_field": 1}}`), &otp)
+	if err == nil {
+		t.Error("expected error for unknown field")
+	}
+	err = json.Unmarshal([]byte(`{"0xc1": 2}`), &otp)
+	if err == nil {
+		t.Error("expected error clearing programmed bits")
+	}
+}
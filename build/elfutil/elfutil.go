@@ -1,7 +1,9 @@
 package elfutil
 
 import (
+	"bytes"
 	"debug/elf"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"io"
@@ -169,3 +171,144 @@ func min[T integer](a, b T) T {
 	}
 	return b
 }
+
+// PatchROM returns a copy of the ELF file contents elfData with its ROM program memory overwritten by rom, which
+// starts at address romAddr. ROM past the end of the ELF's ROM program memory is written to a new PT_LOAD segment
+// appended to the end of the file along with a new program header table. So that tools working with sections, such as
+// objcopy, also see it, a [PatchSectionName] section covering the new segment is added to a copy of the section header
+// table appended to the file. ELF files without section headers get no new section.
+// Only 32 bit little endian ELF files are supported, which covers ARM and RISC-V microcontroller targets.
+func PatchROM(elfData []byte, rom []byte, romAddr uint64) ([]byte, error) {
+	f, err := elf.NewFile(bytes.NewReader(elfData))
+	if err != nil {
+		return nil, err
+	} else if f.Class != elf.ELFCLASS32 || f.Data != elf.ELFDATA2LSB {
+		return nil, errors.New("only 32 bit little endian ELF supported")
+	}
+	const (
+		offPhoff     = 28
+		offPhentsize = 42
+		offPhnum     = 44
+		phentsize    = 32
+	)
+	phoff := binary.LittleEndian.Uint32(elfData[offPhoff:])
+	if binary.LittleEndian.Uint16(elfData[offPhentsize:]) != phentsize {
+		return nil, errors.New("unexpected ELF program header size")
+	} else if uint64(phoff)+uint64(len(f.Progs))*phentsize > uint64(len(elfData)) {
+		return nil, errors.New("ELF program header table out of bounds")
+	}
+	out := append([]byte{}, elfData...)
+	romEnd := romAddr + uint64(len(rom))
+	progEnd := romAddr
+	for _, prog := range f.Progs {
+		if prog.Type == elf.PT_PHDR {
+			return nil, errors.New("ELF with PT_PHDR segment not supported")
+		}
+		pend := prog.Paddr + prog.Filesz
+		if !ProgIsROM(prog) || !aliases(romAddr, romEnd, prog.Paddr, pend) {
+			continue
+		} else if prog.Off+prog.Filesz > uint64(len(elfData)) {
+			return nil, fmt.Errorf("ELF prog at %#x out of file bounds", prog.Paddr)
+		}
+		start := max(romAddr, prog.Paddr)
+		end := min(romEnd, pend)
+		copy(out[prog.Off+start-prog.Paddr:], rom[start-romAddr:end-romAddr])
+		progEnd = max(progEnd, pend)
+	}
+	if progEnd >= romEnd {
+		return out, nil // All ROM fits in existing segments.
+	} else if progEnd == romAddr {
+		return nil, errors.New("ROM not contained in ELF program memory")
+	} else if romEnd > math.MaxUint32 {
+		return nil, errors.New("ROM end address overflows 32 bits")
+	}
+	extra := rom[progEnd-romAddr:]
+	out = padTo(out, 4)
+	segOff := len(out)
+	out = append(out, extra...)
+	out = padTo(out, 4)
+	newPhoff := len(out)
+	out = append(out, elfData[phoff:phoff+uint32(len(f.Progs))*phentsize]...)
+	var ph [phentsize]byte
+	binary.LittleEndian.PutUint32(ph[0:], uint32(elf.PT_LOAD))
+	binary.LittleEndian.PutUint32(ph[4:], uint32(segOff))
+	binary.LittleEndian.PutUint32(ph[8:], uint32(progEnd))  // Virtual address.
+	binary.LittleEndian.PutUint32(ph[12:], uint32(progEnd)) // Physical address.
+	binary.LittleEndian.PutUint32(ph[16:], uint32(len(extra)))
+	binary.LittleEndian.PutUint32(ph[20:], uint32(len(extra)))
+	binary.LittleEndian.PutUint32(ph[24:], uint32(elf.PF_R))
+	binary.LittleEndian.PutUint32(ph[28:], 1)
+	out = append(out, ph[:]...)
+	if uint64(newPhoff) > math.MaxUint32 || len(f.Progs)+1 > math.MaxUint16 {
+		return nil, errors.New("ELF too large")
+	}
+	binary.LittleEndian.PutUint32(out[offPhoff:], uint32(newPhoff))
+	binary.LittleEndian.PutUint16(out[offPhnum:], uint16(len(f.Progs)+1))
+	return appendSection(out, PatchSectionName, uint32(progEnd), uint32(segOff), uint32(len(extra)))
+}
+
+// PatchSectionName is the name of the section added by [PatchROM] for ROM past the end of the ELF's program memory.
+const PatchSectionName = ".rom_patch"
+
+// appendSection adds an allocated PROGBITS section with the name covering size bytes at file offset off, loaded at addr,
+// to the 32 bit little endian ELF file contents out. The section header table and section name string table are copied
+// to the end of the file with the new section and name appended.
+func appendSection(out []byte, name string, addr, off, size uint32) ([]byte, error) {
+	const (
+		offShoff     = 32
+		offShentsize = 46
+		offShnum     = 48
+		offShstrndx  = 50
+		shentsize    = 40
+	)
+	shoff := binary.LittleEndian.Uint32(out[offShoff:])
+	shnum := uint32(binary.LittleEndian.Uint16(out[offShnum:]))
+	shstrndx := uint32(binary.LittleEndian.Uint16(out[offShstrndx:]))
+	if shoff == 0 || shnum == 0 || shstrndx == uint32(elf.SHN_UNDEF) {
+		return out, nil // No section headers to update.
+	} else if binary.LittleEndian.Uint16(out[offShentsize:]) != shentsize {
+		return nil, errors.New("unexpected ELF section header size")
+	} else if shstrndx >= shnum || uint64(shoff)+uint64(shnum)*shentsize > uint64(len(out)) {
+		return nil, errors.New("ELF section header table out of bounds")
+	} else if shnum+1 >= uint32(elf.SHN_LORESERVE) {
+		return nil, errors.New("too many ELF sections")
+	}
+	shdrs := out[shoff : shoff+shnum*shentsize]
+	strhdr := shdrs[shstrndx*shentsize:]
+	stroff, strsize := binary.LittleEndian.Uint32(strhdr[16:]), binary.LittleEndian.Uint32(strhdr[20:])
+	if uint64(stroff)+uint64(strsize) > uint64(len(out)) {
+		return nil, errors.New("ELF section name string table out of bounds")
+	}
+	newStroff := len(out)
+	out = append(out, out[stroff:stroff+strsize]...)
+	out = append(out, name...)
+	out = append(out, 0)
+	out = padTo(out, 4)
+	newShoff := len(out)
+	out = append(out, shdrs...)
+	newStrhdr := out[newShoff+int(shstrndx)*shentsize:]
+	binary.LittleEndian.PutUint32(newStrhdr[16:], uint32(newStroff))
+	binary.LittleEndian.PutUint32(newStrhdr[20:], strsize+uint32(len(name))+1)
+	var sh [shentsize]byte
+	binary.LittleEndian.PutUint32(sh[0:], strsize) // Name offset in string table.
+	binary.LittleEndian.PutUint32(sh[4:], uint32(elf.SHT_PROGBITS))
+	binary.LittleEndian.PutUint32(sh[8:], uint32(elf.SHF_ALLOC))
+	binary.LittleEndian.PutUint32(sh[12:], addr)
+	binary.LittleEndian.PutUint32(sh[16:], off)
+	binary.LittleEndian.PutUint32(sh[20:], size)
+	binary.LittleEndian.PutUint32(sh[32:], 1) // Alignment.
+	out = append(out, sh[:]...)
+	if uint64(len(out)) > math.MaxUint32 {
+		return nil, errors.New("ELF too large")
+	}
+	binary.LittleEndian.PutUint32(out[offShoff:], uint32(newShoff))
+	binary.LittleEndian.PutUint16(out[offShnum:], uint16(shnum+1))
+	return out, nil
+}
+
+func padTo(b []byte, align int) []byte {
+	for len(b)%align != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
@@ -311,10 +311,10 @@ func (blks *BlocksReaderAt) ReadAt(b []byte, addr int64) (int, error) {
 		if !aliases(addr, end, blkAddr, blkEnd) {
 			continue
 		}
-		// progOff := max(0, addr-blkAddr)
+		blkOff := max(0, addr-blkAddr)
 		bOff := max(0, blkAddr-addr)
-		n := copy(b[bOff:], blocks[i].RawData[:blocks[i].PayloadSize])
-		maxRead = int(bOff) + n
+		n := copy(b[bOff:], blocks[i].RawData[blkOff:blocks[i].PayloadSize])
+		maxRead = max(maxRead, int(bOff)+n)
 	}
 	return maxRead, nil
 }
@@ -0,0 +1,38 @@
+package uf2
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBlocksReaderAt(t *testing.T) {
+	const addr = 0x10000000
+	data := make([]byte, 1000)
+	for i := range data {
+		data[i] = byte(i * 7)
+	}
+	f := Formatter{ChunkSize: 256}
+	uf2prog, _, err := f.AppendTo(nil, data, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, _, err := DecodeAppendBlocks(nil, bytes.NewReader(uf2prog), make([]byte, BlockSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd, err := NewBlocksReaderAt(blocks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Reads at offsets inside a block and spanning several blocks.
+	for _, r := range [][2]int{{0, 1000}, {100, 300}, {255, 2}, {300, 600}, {900, 100}} {
+		off, n := r[0], r[1]
+		got := make([]byte, n)
+		nr, err := rd.ReadAt(got, addr+int64(off))
+		if err != nil || nr != n {
+			t.Errorf("ReadAt(%d, %d): read %d (%v)", off, n, nr, err)
+		} else if !bytes.Equal(got, data[off:off+n]) {
+			t.Errorf("ReadAt(%d, %d): data mismatch", off, n)
+		}
+	}
+}
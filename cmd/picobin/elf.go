@@ -2,6 +2,7 @@ package main
 
 import (
 	"debug/elf"
+	"errors"
 	"fmt"
 	"io"
 
@@ -21,16 +22,11 @@ func elfinfo(r io.ReaderAt, flags Flags) error {
 		totalSize += int(sect.Size)
 	}
 	fmt.Printf("total program memory=%d\n", totalSize)
-	ROM, romstart, err := elfROM(f, flags)
+	rd, romstart, romend, err := elfROMReader(f)
 	if err != nil {
 		return err
 	}
-	blocks, block0off, err := romBlocks(ROM, romstart)
-	if err != nil {
-		return err
-	}
-	block0Addr := romstart + uint64(block0off)
-	return blockInfo(blocks, block0Addr, flags)
+	return romInfo(rd, romstart, romend, flags)
 }
 
 func elfdump(r io.ReaderAt, flags Flags) error {
@@ -38,35 +34,45 @@ func elfdump(r io.ReaderAt, flags Flags) error {
 	if err != nil {
 		return err
 	}
-	ROM, romstart, err := elfROM(f, flags)
+	rd, romstart, _, err := elfROMReader(f)
 	if err != nil {
 		return err
 	}
-	return romDump(ROM, romstart, flags)
+	return romDump(rd, romstart, flags)
 }
 
 func elfROM(f *elf.File, flags Flags) (ROM []byte, romAddr uint64, err error) {
-	uromStart, uromEnd, err := elfutil.ROMAddr(f)
+	rd, romStart, romEnd, err := elfROMReader(f)
 	if err != nil {
-		return nil, 0, err
+		return nil, romStart, err
 	}
-	err = elfutil.EnsureROMContiguous(f, uromStart, uromEnd, 0)
+	ROM, err = readROM(rd, romStart, romEnd, flags)
+	return ROM, romStart, err
+}
+
+// elfROMReader returns a reader of the ELF's contiguous ROM addressed with absolute addresses and the ROM's address range.
+func elfROMReader(f *elf.File) (rd io.ReaderAt, romStart, romEnd uint64, err error) {
+	romStart, romEnd, err = elfutil.ROMAddr(f)
 	if err != nil {
-		return nil, uromStart, err
-	}
-	romSize := uromEnd - uromStart
-	if romSize > uint64(flags.readsize) {
-		fmt.Printf("ROM %d too large, limiting to %d\n", romSize, flags.readsize)
-		romSize = uint64(flags.readsize)
+		return nil, 0, 0, err
 	}
-	ROM = make([]byte, romSize)
-	flashEnd, err := elfutil.ReadROMAt(f, ROM[:], uromStart)
+	err = elfutil.EnsureROMContiguous(f, romStart, romEnd, 0)
 	if err != nil {
-		return nil, 0, err
-	} else if flashEnd > int(flags.readsize) {
-		return nil, 0, fmt.Errorf("flash size too large %d", flashEnd) // Should never happen...
+		return nil, romStart, romEnd, err
+	}
+	return elfROMReaderAt{f: f}, romStart, romEnd, nil
+}
+
+// elfROMReaderAt reads the ROM of an ELF file with absolute addressing.
+type elfROMReaderAt struct {
+	f *elf.File
+}
+
+func (r elfROMReaderAt) ReadAt(b []byte, addr int64) (int, error) {
+	if addr < 0 {
+		return 0, errors.New("negative ROM address")
 	}
-	return ROM[:flashEnd], uromStart, nil
+	return elfutil.ReadROMAt(r.f, b, uint64(addr))
 }
 
 // helper function that discards sections and program memory of no interest to us.
@@ -10,6 +10,7 @@ import (
 	"os"
 
 	"github.com/soypat/tinyboot/boot/picobin"
+	"github.com/soypat/tinyboot/boot/rp2040boot2"
 )
 
 const (
@@ -29,6 +30,8 @@ type Flags struct {
 	readsize      uint
 	flashend      uint64
 	familyID      uint
+	candidates    bool
+	seal          sealFlags
 }
 
 func main() {
@@ -43,14 +46,27 @@ func run() error {
 	flag.Usage = func() {
 		output := flag.CommandLine.Output()
 		fmt.Fprintf(output, "Usage of %s:\n", os.Args[0])
-		fmt.Fprintf(output, "\tavailable commands: [elfinfo, elfdump, uf2info, uf2dump, uf2conv]\n")
+		fmt.Fprintf(output, "\tavailable commands: [elfinfo, elfdump, uf2info, uf2dump, uf2conv, seal]\n")
 		fmt.Fprintf(output, "Example:\n\tpicobin [flags] <command> <filename>\n")
 		flag.PrintDefaults()
 	}
 	flag.IntVar(&flags.block, "block", -1, "Specify a single block to analyze")
-	flag.UintVar(&flags.readsize, "readlim", 2*MB, "Size of haystack to look for blocks in, starting at ROM start address")
+	flag.UintVar(&flags.readsize, "readlim", 2*MB, "Maximum size of ROM read into memory for hash verification and conversion, starting at ROM start address. Blocks are read on demand")
 	flag.Uint64Var(&flags.flashend, "flashend", defaultFlashEnd, "End limit of flash memory. All memory past this limit is ignored.")
+	flag.BoolVar(&flags.candidates, "candidates", false, "Report all block start marker candidates in the first 4kB of ROM and why invalid ones are skipped")
 	flag.UintVar(&flags.familyID, "familyid", rp2350FamilyID, "Family ID for UF2 generation.")
+	flag.StringVar(&flags.seal.output, "o", "", "seal: Output filename. Extension selects format: .elf, .bin or .uf2")
+	flag.StringVar(&flags.seal.cpu, "cpu", "arm", "seal: Image CPU architecture: arm or riscv")
+	flag.StringVar(&flags.seal.sec, "sec", "s", "seal: Image security: s (secure) or ns (non-secure)")
+	flag.BoolVar(&flags.seal.tbyb, "tbyb", false, "seal: Mark image as try before you buy")
+	flag.Uint64Var(&flags.seal.vtor, "vtor", 0, "seal: Add VECTOR_TABLE item with vector table address")
+	flag.BoolVar(&flags.seal.entry, "entry", false, "seal: Add ENTRY_POINT item with ELF entry and initial stack pointer from vector table")
+	flag.StringVar(&flags.seal.version, "version", "", "seal: Add VERSION item with version major.minor")
+	flag.UintVar(&flags.seal.rollback, "rollback", 0, "seal: Rollback version of VERSION item, requires -otprows")
+	flag.StringVar(&flags.seal.otprows, "otprows", "", "seal: Comma separated OTP rows storing the thermometer coded rollback version, i.e: 0x100,0x101")
+	flag.BoolVar(&flags.seal.loadmap, "loadmap", false, "seal: Add LOAD_MAP item derived from ELF PT_LOAD segments")
+	flag.BoolVar(&flags.seal.hash, "hash", false, "seal: Add HASH_DEF and HASH_VALUE items")
+	flag.StringVar(&flags.seal.keyfile, "key", "", "seal: Sign image with secp256k1 PEM private key file, implies -hash")
 	flag.Parse()
 	command := flag.Arg(0)
 	source := flag.Arg(1)
@@ -77,6 +93,9 @@ func run() error {
 	case "uf2conv":
 		cmd = uf2conv
 
+	case "seal":
+		cmd = seal
+
 	default:
 		flag.Usage()
 		return errors.New("uknown command: " + command)
@@ -97,54 +116,72 @@ func run() error {
 	return cmd(file, flags)
 }
 
-func romBlocks(ROM []byte, romStartAddr uint64) (blocks []picobin.Block, block0Off int, err error) {
-	block0Off, _, err = picobin.NextBlockIdx(ROM)
+// romInfo prints information on the ROM starting at romStartAddr of rd, which is addressed with absolute addresses.
+// Only the blocks are read from rd unless a block's hash needs to be verified.
+func romInfo(rd io.ReaderAt, romStartAddr, romEndAddr uint64, flags Flags) error {
+	boot2Info(rd, romStartAddr)
+	if flags.candidates {
+		blockCandidates(rd, romStartAddr)
+	}
+	loop, err := romBlocks(rd, romStartAddr)
 	if err != nil {
-		return nil, 0, err
-	}
-	seenAddrs := make(map[int]struct{})
-	seenAddrs[block0Off] = struct{}{}
-	start := block0Off
-	for {
-		absAddr := uint64(start) + romStartAddr
-		block, _, err := picobin.DecodeBlock(ROM[start:])
-		if err != nil {
-			return blocks, block0Off, fmt.Errorf("decoding block at Addr=%#x: %w", absAddr, err)
-		}
-		blocks = append(blocks, block)
-		nextStart := start + block.Link
-		_, alreadySeen := seenAddrs[nextStart]
-		if alreadySeen {
-			if nextStart == block0Off {
-				break // Found last block.
-			}
-			return blocks, block0Off, fmt.Errorf("odd cyclic block at Addr=%#x", absAddr)
-		}
-		seenAddrs[nextStart] = struct{}{}
-		start = nextStart
+		return err
 	}
-	return blocks, block0Off, nil
+	err = blockInfo(loop, romStartAddr, flags)
+	if err != nil {
+		return err
+	}
+	verifyHashes(rd, romStartAddr, romEndAddr, loop, flags)
+	return nil
 }
 
-func blockInfo(blocks []picobin.Block, block0StartAddr uint64, flags Flags) (err error) {
-	if len(blocks) == 0 {
+// readROM reads the ROM between romStartAddr and romEndAddr of rd into memory, limited to the readlim flag.
+func readROM(rd io.ReaderAt, romStartAddr, romEndAddr uint64, flags Flags) ([]byte, error) {
+	romSize := romEndAddr - romStartAddr
+	if romSize > uint64(flags.readsize) {
+		fmt.Printf("ROM %d too large, limiting to %d\n", romSize, flags.readsize)
+		romSize = uint64(flags.readsize)
+	}
+	ROM := make([]byte, romSize)
+	n, err := rd.ReadAt(ROM, int64(romStartAddr))
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return ROM[:n], nil
+}
+
+// romBlocks reads the block loop of the ROM starting at romStartAddr of rd, which is addressed with absolute addresses.
+func romBlocks(rd io.ReaderAt, romStartAddr uint64) (picobin.BlockLoop, error) {
+	block0Off, err := picobin.FirstBlockIdxAt(rd, int64(romStartAddr))
+	if err != nil {
+		return picobin.BlockLoop{}, err
+	}
+	loop, err := picobin.ReadBlockLoopAt(rd, int64(romStartAddr), block0Off)
+	if err != nil {
+		return loop, fmt.Errorf("block loop in ROM @ Addr=%#x: %w", romStartAddr, err)
+	}
+	return loop, nil
+}
+
+func blockInfo(loop picobin.BlockLoop, romStartAddr uint64, flags Flags) (err error) {
+	if loop.Len() == 0 {
 		return errors.New("no blocks found")
 	}
 	fmt.Println("ROM Block info:")
-	addr := block0StartAddr
-	for i, block := range blocks {
+	for i, block := range loop.Blocks {
 		if flags.block >= 0 && i != flags.block {
-			addr += uint64(block.Link)
 			continue
 		}
-
+		addr := romStartAddr + uint64(block.Offset)
 		fmt.Printf("BLOCK%d @ Addr=%#x Size=%d Items=%d\n", i, addr, block.Size(), len(block.Items))
 		for _, item := range block.Items {
 			fmt.Printf("\t%s\n", item.String())
+			if item.ItemType() == picobin.ItemTypePartitionTable {
+				printPartitions(picobin.PartitionTable{Item: item})
+			}
 		}
-		addr += uint64(block.Link)
 	}
-	for i, block := range blocks {
+	for i, block := range loop.Blocks {
 		err = block.Validate()
 		if err != nil {
 			fmt.Printf("BLOCK%d failed to validate:\n\t%s\n", i, err.Error())
@@ -153,29 +190,103 @@ func blockInfo(blocks []picobin.Block, block0StartAddr uint64, flags Flags) (err
 	return nil
 }
 
-func romDump(ROM []byte, startAddr uint64, flags Flags) (err error) {
-	blocks, block0Start, err := romBlocks(ROM, startAddr)
+// blockCandidates prints every block start marker candidate the bootrom considers when searching for the first block.
+func blockCandidates(rd io.ReaderAt, romStartAddr uint64) {
+	fmt.Println("Block candidates in first 4kB:")
+	cands, err := picobin.ScanBlocksAt(rd, int64(romStartAddr))
+	if err != nil {
+		fmt.Printf("\tfailed to read search window: %s\n", err.Error())
+	}
+	for _, cand := range cands {
+		addr := romStartAddr + uint64(cand.Offset)
+		if cand.Err != nil {
+			fmt.Printf("\tAddr=%#x skipped: %s\n", addr, cand.Err.Error())
+		} else {
+			fmt.Printf("\tAddr=%#x valid block loop with %d blocks\n", addr, cand.Loop.Len())
+		}
+	}
+}
+
+// verifyHashes verifies the hash of every block with a hash value item. The ROM is only read into memory if a block has a hash.
+func verifyHashes(rd io.ReaderAt, romStartAddr, romEndAddr uint64, loop picobin.BlockLoop, flags Flags) {
+	var ROM []byte
+	for i, block := range loop.Blocks {
+		addr := romStartAddr + uint64(block.Offset)
+		hasHash := false
+		for _, item := range block.Items {
+			hasHash = hasHash || item.ItemType() == picobin.ItemTypeHashValue
+		}
+		if !hasHash {
+			continue
+		}
+		if ROM == nil {
+			var err error
+			ROM, err = readROM(rd, romStartAddr, romEndAddr, flags)
+			if err != nil {
+				fmt.Printf("failed to read ROM to verify hashes: %s\n", err.Error())
+				return
+			}
+		}
+		err := picobin.VerifyHash(block.Block, uint32(addr), ROM, uint32(romStartAddr))
+		if err != nil {
+			fmt.Printf("BLOCK%d hash failed to verify:\n\t%s\n", i, err.Error())
+		} else {
+			fmt.Printf("BLOCK%d hash verified\n", i)
+		}
+	}
+}
+
+// boot2Info prints information on the RP2040 second stage bootloader if ROM starts with one.
+func boot2Info(rd io.ReaderAt, romStartAddr uint64) {
+	if romStartAddr != rp2040boot2.FlashAddr {
+		return
+	}
+	var boot2 rp2040boot2.Boot2
+	n, _ := rd.ReadAt(boot2[:], int64(romStartAddr))
+	if n != len(boot2) || boot2.Validate() != nil {
+		return
+	}
+	fmt.Printf("RP2040 boot2 @ Addr=%#x variant=%s crc=%#08x\n", romStartAddr, boot2.Identify().String(), boot2.StoredCRC())
+}
+
+func printPartitions(pt picobin.PartitionTable) {
+	parts, err := pt.Partitions()
+	for i, p := range parts {
+		fmt.Printf("\t\t%d: %s\n", i, p.String())
+	}
+	if err != nil {
+		fmt.Printf("\t\tpartition table failed to decode: %s\n", err.Error())
+	} else if err = picobin.ValidatePartitions(parts); err != nil {
+		fmt.Printf("\t\tpartition table failed to validate:\n\t\t%s\n", err.Error())
+	}
+}
+
+func romDump(rd io.ReaderAt, startAddr uint64, flags Flags) (err error) {
+	loop, err := romBlocks(rd, startAddr)
 	if err != nil {
 		return err
 	}
-	off := block0Start
-	for i, block := range blocks {
+	for i, block := range loop.Blocks[:loop.Len()-1] { // Last block links back to first.
 		if flags.block >= 0 && i != flags.block || len(block.Items) >= 1 && block.Items[0].ItemType() == picobin.ItemTypeIgnored {
-			off += int(block.Link)
 			continue
 		}
-		nextOff := off + block.Link
-		if nextOff == block0Start {
-			break // Last block.
+		nextOff := block.Offset + block.Link
+		addr := startAddr + uint64(block.Offset)
+		if nextOff <= block.Offset {
+			return fmt.Errorf("BLOCK%d @ Addr=%#x links backwards to offset %#x, cannot dump", i, addr, nextOff)
+		}
+		data := make([]byte, nextOff-block.Offset)
+		n, err := rd.ReadAt(data, int64(addr))
+		if n != len(data) {
+			if err == nil {
+				err = io.ErrUnexpectedEOF
+			}
+			return fmt.Errorf("reading BLOCK%d @ Addr=%#x: %w", i, addr, err)
 		}
-		addr := startAddr + uint64(off)
-
 		fmt.Printf("\nBLOCK%d @ Addr=%#x dump:\n", i, addr)
 		hd := hex.Dumper(os.Stdout)
-		hd.Write(ROM[off:nextOff])
+		hd.Write(data)
 		hd.Close()
-
-		off += int(block.Link)
 	}
 	return nil
 }
@@ -3,8 +3,15 @@ package main
 import (
 	"bytes"
 	"debug/elf"
+	"io"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/soypat/tinyboot/boot/picobin"
+	"github.com/soypat/tinyboot/build/elfutil"
 )
 
 func TestDump(t *testing.T) {
@@ -49,4 +56,181 @@ func TestDump(t *testing.T) {
 	if !bytes.Equal(elfrom, uf2rom) {
 		t.Error("ELF/UF2 content mismatch")
 	}
+	// Block loops read on demand match the ones decoded from the ROM in memory.
+	block0Off, err := picobin.FirstBlockIdx(elfrom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := picobin.DecodeBlockLoop(elfrom, block0Off)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elfrd, _, _, err := elfROMReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uf2rd, _, _, err := uf2ROMReader(uf2blocks, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rd := range []io.ReaderAt{elfrd, uf2rd} {
+		loop, err := romBlocks(rd, elfStartAddr)
+		if err != nil {
+			t.Fatal(err)
+		} else if !reflect.DeepEqual(loop, want) {
+			t.Errorf("block loop read on demand mismatch:\n%+v\n%+v", loop, want)
+		}
+	}
+}
+
+func TestDumpOutput(t *testing.T) {
+	fp, err := os.Open("../../testdata/blink.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	f, err := elf.NewFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd, romStart, _, err := elfROMReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Capture standard output written by romDump.
+	pr, pw, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = pw
+	done := make(chan []byte)
+	go func() {
+		b, _ := io.ReadAll(pr)
+		done <- b
+	}()
+	err = romDump(rd, romStart, Flags{block: -1})
+	os.Stdout = stdout
+	pw.Close()
+	out := string(<-done)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Block 0 is dumped up to the next block in the loop, 0x1570 bytes later.
+	const (
+		wantStart = "\nBLOCK0 @ Addr=0x10000138 dump:\n" +
+			"00000000  d3 de ff ff 42 01 21 10  ff 01 00 00 70 15 00 00  |....B.!.....p...|\n" +
+			"00000010  79 35 12 ab 4f f0 00 00  20 49 08 60 06 c8 81 f3  |y5..O... I.`....|\n"
+		wantEnd = "00001560  00 00 00 00 58 02 00 20  00 00 00 00 00 00 00 00  |....X.. ........|\n"
+	)
+	if !strings.HasPrefix(out, wantStart) {
+		t.Errorf("dump output start mismatch:\n%.300s", out)
+	}
+	if !strings.HasSuffix(out, wantEnd) {
+		tail := out
+		if len(tail) > 300 {
+			tail = tail[len(tail)-300:]
+		}
+		t.Errorf("dump output end mismatch:\n%s", tail)
+	}
+	if lines := strings.Count(out, "\n"); lines != 345 {
+		t.Errorf("dump output has %d lines, want 345", lines)
+	}
+}
+
+func TestSeal(t *testing.T) {
+	file := "../../testdata/blink.elf"
+	fp, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fp.Close()
+	dir := t.TempDir()
+	flags := Flags{readsize: 2 * MB, argSourcename: file, flashend: defaultFlashEnd, familyID: rp2350FamilyID}
+	flags.seal = sealFlags{cpu: "arm", sec: "s", entry: true, version: "1.2", rollback: 3, otprows: "0x100, 0x101", loadmap: true, hash: true}
+
+	flags.seal.output = filepath.Join(dir, "sealed.elf")
+	err = seal(fp, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fpelf, err := os.Open(flags.seal.output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fpelf.Close()
+	f, err := newElfFile(fpelf, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	elfrom, elfStart, err := elfROM(f, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkSealed(t, elfrom, elfStart)
+	// The block appended past the ELF's program memory is also covered by a section.
+	sec := f.Section(elfutil.PatchSectionName)
+	if sec == nil {
+		t.Fatalf("sealed ELF missing %s section", elfutil.PatchSectionName)
+	}
+	secData, err := sec.Data()
+	if err != nil {
+		t.Fatal(err)
+	} else if sec.Addr < elfStart || !bytes.Equal(secData, elfrom[sec.Addr-elfStart:][:len(secData)]) {
+		t.Errorf("%s section at %#x does not match sealed ROM", sec.Name, sec.Addr)
+	} else if _, _, err = picobin.DecodeBlock(secData); err != nil {
+		t.Errorf("%s section: %v", sec.Name, err)
+	}
+
+	flags.seal.output = filepath.Join(dir, "sealed.uf2")
+	err = seal(fp, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fpuf2, err := os.Open(flags.seal.output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fpuf2.Close()
+	uf2blocks, err := newUF2File(fpuf2, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	uf2rom, uf2Start, err := uf2ROM(uf2blocks, flags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uf2Start != elfStart || !bytes.Equal(uf2rom, elfrom) {
+		t.Error("sealed ELF/UF2 ROM mismatch")
+	}
+}
+
+func checkSealed(t *testing.T, ROM []byte, romStart uint64) {
+	t.Helper()
+	block0Off, err := picobin.FirstBlockIdx(ROM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loop, err := picobin.DecodeBlockLoop(ROM, block0Off)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := loop.Blocks[loop.Len()-1]
+	if last.Items[0].ItemType() != picobin.ItemTypeImageDef {
+		t.Fatalf("sealed block does not start with IMAGE_DEF: %s", last.Items)
+	}
+	want, _ := picobin.MakeVersion(1, 2, 3, []uint16{0x100, 0x101})
+	var found bool
+	for _, item := range last.Items {
+		if item.ItemType() == picobin.ItemTypeVersion {
+			found = picobin.Version{Item: item}.Compare(want) == 0
+		}
+	}
+	if !found {
+		t.Errorf("sealed block missing version %s: %s", want, last.Items)
+	}
+	err = picobin.VerifyHash(last.Block, uint32(romStart)+uint32(last.Offset), ROM, uint32(romStart))
+	if err != nil {
+		t.Error(err)
+	}
 }
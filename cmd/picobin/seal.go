@@ -0,0 +1,197 @@
+package main
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/soypat/tinyboot/boot/picobin"
+	"github.com/soypat/tinyboot/build/elfutil"
+	"github.com/soypat/tinyboot/build/uf2"
+)
+
+// sealFlags are the flags of the seal command.
+type sealFlags struct {
+	output   string
+	cpu      string
+	sec      string
+	tbyb     bool
+	vtor     uint64
+	entry    bool
+	version  string
+	rollback uint
+	otprows  string
+	loadmap  bool
+	hash     bool
+	keyfile  string
+}
+
+func seal(r io.ReaderAt, flags Flags) error {
+	if flags.seal.output == "" {
+		return errors.New("seal requires output filename flag -o")
+	}
+	elfData, err := io.ReadAll(io.NewSectionReader(r, 0, math.MaxInt64))
+	if err != nil {
+		return err
+	}
+	f, err := newElfFile(r, flags)
+	if err != nil {
+		return err
+	}
+	ROM, romStart, err := elfROM(f, flags)
+	if err != nil {
+		return err
+	} else if romStart+uint64(len(ROM)) > math.MaxUint32 {
+		return fmt.Errorf("ROM address %#x overflows uint32", romStart+uint64(len(ROM)))
+	}
+	cfg, err := sealConfig(f, ROM, romStart, flags.seal)
+	if err != nil {
+		return err
+	}
+	sealed, blockAddr, err := picobin.Seal(ROM, uint32(romStart), cfg)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("sealed block @ Addr=%#x\n", blockAddr)
+
+	var out []byte
+	switch ext := strings.ToLower(filepath.Ext(flags.seal.output)); ext {
+	case ".elf":
+		out, err = elfutil.PatchROM(elfData, sealed, romStart)
+	case ".bin":
+		out = sealed
+	case ".uf2":
+		formatter := uf2.Formatter{ChunkSize: 256, FamilyID: uint32(flags.familyID), Flags: uf2.FlagFamilyIDPresent}
+		out, _, err = formatter.AppendTo(nil, sealed, uint32(romStart))
+	default:
+		return fmt.Errorf("unknown output extension %q, want .elf, .bin or .uf2", ext)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println("writing file", flags.seal.output)
+	return os.WriteFile(flags.seal.output, out, 0644)
+}
+
+// sealConfig creates the seal configuration from the ELF file and command line flags.
+func sealConfig(f *elf.File, ROM []byte, romStart uint64, flags sealFlags) (cfg picobin.SealConfig, err error) {
+	cpu := picobin.ExeCPUARM
+	switch flags.cpu {
+	case "arm":
+	case "riscv":
+		cpu = picobin.ExeCPURISCV
+	default:
+		return cfg, fmt.Errorf("unknown CPU %q, want arm or riscv", flags.cpu)
+	}
+	sec := picobin.ExeSecSecure
+	switch flags.sec {
+	case "s":
+	case "ns":
+		sec = picobin.ExeSecNonSecure
+	default:
+		return cfg, fmt.Errorf("unknown security %q, want s or ns", flags.sec)
+	}
+	cfg.ImageDef = picobin.MakeImageDef(picobin.ImageTypeExecutable, sec, cpu, picobin.ExeChipRP2350, flags.tbyb)
+	if flags.vtor != 0 {
+		if flags.vtor > math.MaxUint32 {
+			return cfg, errors.New("vector table address overflows uint32")
+		}
+		cfg.Items = append(cfg.Items, picobin.MakeVectorTable(uint32(flags.vtor)).Item)
+	}
+	if flags.entry {
+		// Initial stack pointer is the first word of the vector table.
+		vtor := romStart
+		if flags.vtor != 0 {
+			vtor = flags.vtor
+		}
+		if vtor < romStart || vtor+4 > romStart+uint64(len(ROM)) {
+			return cfg, fmt.Errorf("vector table %#x outside of ROM", vtor)
+		} else if f.Entry > math.MaxUint32 {
+			return cfg, errors.New("ELF entry point overflows uint32")
+		}
+		sp := binary.LittleEndian.Uint32(ROM[vtor-romStart:])
+		cfg.Items = append(cfg.Items, picobin.MakeEntryPoint(uint32(f.Entry), sp, 0).Item)
+	}
+	if flags.version == "" && (flags.rollback != 0 || flags.otprows != "") {
+		return cfg, errors.New("rollback version and OTP rows require version flag")
+	} else if flags.version != "" {
+		major, minor, err := parseVersion(flags.version)
+		if err != nil {
+			return cfg, err
+		}
+		rows, err := parseOTPRows(flags.otprows)
+		if err != nil {
+			return cfg, err
+		} else if flags.rollback > math.MaxUint16 {
+			return cfg, errors.New("rollback version overflows uint16")
+		}
+		v, err := picobin.MakeVersion(major, minor, uint16(flags.rollback), rows)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Items = append(cfg.Items, v.Item)
+	}
+	if flags.loadmap {
+		entries, err := picobin.LoadMapEntriesFromELF(f)
+		if err != nil {
+			return cfg, err
+		}
+		lm, err := picobin.MakeLoadMap(true, entries)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Items = append(cfg.Items, lm.Item)
+	}
+	cfg.Hash = flags.hash
+	if flags.keyfile != "" {
+		keyPEM, err := os.ReadFile(flags.keyfile)
+		if err != nil {
+			return cfg, err
+		}
+		key, err := picobin.ParsePrivateKeyPEM(keyPEM)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Signer = key
+	}
+	return cfg, nil
+}
+
+// parseVersion parses a "major.minor" version string.
+func parseVersion(s string) (major, minor uint16, err error) {
+	majorStr, minorStr, _ := strings.Cut(s, ".")
+	maj, err := strconv.ParseUint(majorStr, 10, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("bad major version: %w", err)
+	}
+	var min uint64
+	if minorStr != "" {
+		min, err = strconv.ParseUint(minorStr, 10, 16)
+		if err != nil {
+			return 0, 0, fmt.Errorf("bad minor version: %w", err)
+		}
+	}
+	return uint16(maj), uint16(min), nil
+}
+
+// parseOTPRows parses a comma separated list of OTP row numbers.
+func parseOTPRows(s string) (rows []uint16, err error) {
+	if s == "" {
+		return nil, nil
+	}
+	for _, field := range strings.Split(s, ",") {
+		row, err := strconv.ParseUint(strings.TrimSpace(field), 0, 16)
+		if err != nil {
+			return nil, fmt.Errorf("bad OTP row: %w", err)
+		}
+		rows = append(rows, uint16(row))
+	}
+	return rows, nil
+}
@@ -34,15 +34,11 @@ func uf2info(r io.ReaderAt, flags Flags) error {
 		}
 		fmt.Fprintf(os.Stdout, "\t%s sha256=%x\n", block.String(), sum)
 	}
-	ROM, romstart, err := uf2ROM(uf2blocks, flags)
+	rd, romstart, romend, err := uf2ROMReader(uf2blocks, flags)
 	if err != nil {
 		return err
 	}
-	blocks, block0start, err := romBlocks(ROM, romstart)
-	if err != nil {
-		return err
-	}
-	return blockInfo(blocks, romstart+uint64(block0start), flags)
+	return romInfo(rd, romstart, romend, flags)
 }
 
 func uf2conv(r io.ReaderAt, flags Flags) error {
@@ -69,29 +65,29 @@ func uf2conv(r io.ReaderAt, flags Flags) error {
 }
 
 func uf2ROM(uf2blocks []uf2.Block, flags Flags) (ROM []byte, romAddr uint64, err error) {
-	rd, err := uf2.NewBlocksReaderAt(uf2blocks)
+	rd, start, end, err := uf2ROMReader(uf2blocks, flags)
 	if err != nil {
 		return nil, 0, err
 	}
-	start, end := rd.Addrs()
+	ROM, err = readROM(rd, start, end, flags)
+	return ROM, start, err
+}
+
+// uf2ROMReader returns a reader of the UF2 blocks' contents before the flash end limit, addressed with absolute addresses,
+// and the address range of the contents.
+func uf2ROMReader(uf2blocks []uf2.Block, flags Flags) (rd io.ReaderAt, romStart, romEnd uint64, err error) {
+	blks, err := uf2.NewBlocksReaderAt(uf2blocks)
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	start, end := blks.Addrs()
 	if end > uint32(flags.flashend) {
 		end = uint32(flags.flashend)
 	}
-	romsize := int(end) - int(start)
-	if romsize < 0 {
-		return nil, 0, fmt.Errorf("invalid addresses or bad flash address flag start=%#x, flashlim=%#x", start, flags.flashend)
-	} else if romsize > int(flags.readsize) {
-		fmt.Println("limiting ROM read")
-		romsize = int(flags.readsize)
-	}
-	ROM = make([]byte, romsize)
-	n, err := rd.ReadAt(ROM, int64(start))
-	if err != nil {
-		return nil, 0, err
-	} else if n != len(ROM) {
-		fmt.Println("unexpected short read:", n, "of", len(ROM))
+	if end < start {
+		return nil, 0, 0, fmt.Errorf("invalid addresses or bad flash address flag start=%#x, flashlim=%#x", start, flags.flashend)
 	}
-	return ROM, uint64(start), nil
+	return io.NewSectionReader(blks, 0, int64(end)), uint64(start), uint64(end), nil
 }
 
 func uf2dump(r io.ReaderAt, flags Flags) error {
@@ -99,11 +95,11 @@ func uf2dump(r io.ReaderAt, flags Flags) error {
 	if err != nil {
 		return err
 	}
-	ROM, startaddr, err := uf2ROM(uf2blocks, flags)
+	rd, romstart, _, err := uf2ROMReader(uf2blocks, flags)
 	if err != nil {
 		return err
 	}
-	return romDump(ROM, uint64(startaddr), flags)
+	return romDump(rd, romstart, flags)
 }
 
 func newUF2File(r io.ReaderAt, _ Flags) ([]uf2.Block, error) {
@@ -0,0 +1,229 @@
+// Package secp256k1 implements the minimum of the secp256k1 elliptic curve needed to
+// create and verify ECDSA signatures for RP2350 secure boot.
+//
+// The implementation uses math/big and is not constant time. Do not use it where
+// an attacker can measure signing time, use an external signer instead.
+package secp256k1
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"io"
+	"math/big"
+)
+
+// Curve parameters of y² = x³ + 7 over the prime field P.
+var (
+	P  = mustHex("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f")
+	N  = mustHex("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141")
+	Gx = mustHex("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+	Gy = mustHex("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")
+	b  = big.NewInt(7)
+)
+
+// Point is an affine point on the curve. The point at infinity is represented by nil coordinates.
+type Point struct {
+	X, Y *big.Int
+}
+
+// G returns the generator point.
+func G() Point { return Point{X: new(big.Int).Set(Gx), Y: new(big.Int).Set(Gy)} }
+
+// IsInfinity returns true if p is the point at infinity.
+func (p Point) IsInfinity() bool { return p.X == nil }
+
+// IsOnCurve returns true if p is a finite point on the curve.
+func (p Point) IsOnCurve() bool {
+	if p.IsInfinity() || p.X.Sign() < 0 || p.X.Cmp(P) >= 0 || p.Y.Sign() < 0 || p.Y.Cmp(P) >= 0 {
+		return false
+	}
+	y2 := new(big.Int).Mul(p.Y, p.Y)
+	y2.Mod(y2, P)
+	x3 := new(big.Int).Mul(p.X, p.X)
+	x3.Mul(x3, p.X)
+	x3.Add(x3, b)
+	x3.Mod(x3, P)
+	return y2.Cmp(x3) == 0
+}
+
+// Add returns p+q.
+func Add(p, q Point) Point {
+	switch {
+	case p.IsInfinity():
+		return q
+	case q.IsInfinity():
+		return p
+	case p.X.Cmp(q.X) == 0:
+		if p.Y.Cmp(q.Y) != 0 || p.Y.Sign() == 0 {
+			return Point{} // p = -q.
+		}
+		return Double(p)
+	}
+	// λ = (qy-py)/(qx-px)
+	num := new(big.Int).Sub(q.Y, p.Y)
+	den := new(big.Int).Sub(q.X, p.X)
+	den.Mod(den, P)
+	den.ModInverse(den, P)
+	lambda := num.Mul(num, den)
+	lambda.Mod(lambda, P)
+	return fromLambda(lambda, p, q.X)
+}
+
+// Double returns 2p.
+func Double(p Point) Point {
+	if p.IsInfinity() || p.Y.Sign() == 0 {
+		return Point{}
+	}
+	// λ = 3px²/2py
+	num := new(big.Int).Mul(p.X, p.X)
+	num.Mul(num, big.NewInt(3))
+	den := new(big.Int).Lsh(p.Y, 1)
+	den.ModInverse(den, P)
+	lambda := num.Mul(num, den)
+	lambda.Mod(lambda, P)
+	return fromLambda(lambda, p, p.X)
+}
+
+// fromLambda computes the sum of p and a point with x coordinate qx given the slope λ.
+func fromLambda(lambda *big.Int, p Point, qx *big.Int) Point {
+	x := new(big.Int).Mul(lambda, lambda)
+	x.Sub(x, p.X)
+	x.Sub(x, qx)
+	x.Mod(x, P)
+	y := new(big.Int).Sub(p.X, x)
+	y.Mul(y, lambda)
+	y.Sub(y, p.Y)
+	y.Mod(y, P)
+	return Point{X: x, Y: y}
+}
+
+// ScalarMult returns k*p.
+func ScalarMult(p Point, k *big.Int) Point {
+	var r Point
+	for i := k.BitLen() - 1; i >= 0; i-- {
+		r = Double(r)
+		if k.Bit(i) != 0 {
+			r = Add(r, p)
+		}
+	}
+	return r
+}
+
+// ScalarBaseMult returns k*G.
+func ScalarBaseMult(k *big.Int) Point { return ScalarMult(G(), k) }
+
+// GenerateKey returns a random private key in [1, N-1] read from rand.
+func GenerateKey(rand io.Reader) (*big.Int, error) {
+	var buf [32]byte
+	for i := 0; i < 64; i++ {
+		_, err := io.ReadFull(rand, buf[:])
+		if err != nil {
+			return nil, err
+		}
+		d := new(big.Int).SetBytes(buf[:])
+		if d.Sign() > 0 && d.Cmp(N) < 0 {
+			return d, nil
+		}
+	}
+	return nil, errors.New("failed to generate private key")
+}
+
+// Sign signs the digest with private key d using a deterministic nonce as specified by RFC 6979 with SHA-256.
+func Sign(d *big.Int, digest []byte) (r, s *big.Int, err error) {
+	if d.Sign() <= 0 || d.Cmp(N) >= 0 {
+		return nil, nil, errors.New("invalid private key")
+	}
+	e := hashToInt(digest)
+	next := nonces(d, e)
+	for i := 0; i < 64; i++ {
+		k := next()
+		R := ScalarBaseMult(k)
+		r = new(big.Int).Mod(R.X, N)
+		if r.Sign() == 0 {
+			continue
+		}
+		// s = k⁻¹(e + rd) mod N
+		s = new(big.Int).Mul(r, d)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, N))
+		s.Mod(s, N)
+		if s.Sign() != 0 {
+			return r, s, nil
+		}
+	}
+	return nil, nil, errors.New("failed to find valid nonce")
+}
+
+// Verify returns true if r, s is a valid signature of digest for public key pub.
+func Verify(pub Point, digest []byte, r, s *big.Int) bool {
+	if !pub.IsOnCurve() || r.Sign() <= 0 || s.Sign() <= 0 || r.Cmp(N) >= 0 || s.Cmp(N) >= 0 {
+		return false
+	}
+	e := hashToInt(digest)
+	w := new(big.Int).ModInverse(s, N)
+	u1 := e.Mul(e, w)
+	u1.Mod(u1, N)
+	u2 := w.Mul(r, w)
+	u2.Mod(u2, N)
+	R := Add(ScalarBaseMult(u1), ScalarMult(pub, u2))
+	if R.IsInfinity() {
+		return false
+	}
+	v := R.X.Mod(R.X, N)
+	return v.Cmp(r) == 0
+}
+
+// nonces returns a generator of RFC 6979 nonce candidates for private key d and hashed message e.
+func nonces(d, e *big.Int) func() *big.Int {
+	var x, h1 [32]byte
+	d.FillBytes(x[:])
+	new(big.Int).Mod(e, N).FillBytes(h1[:])
+	K := make([]byte, 32)
+	V := make([]byte, 32)
+	for i := range V {
+		V[i] = 1
+	}
+	mac := func(key []byte, data ...[]byte) []byte {
+		h := hmac.New(sha256.New, key)
+		for _, d := range data {
+			h.Write(d)
+		}
+		return h.Sum(nil)
+	}
+	K = mac(K, V, []byte{0}, x[:], h1[:])
+	V = mac(K, V)
+	K = mac(K, V, []byte{1}, x[:], h1[:])
+	V = mac(K, V)
+	first := true
+	return func() *big.Int {
+		for {
+			if !first {
+				K = mac(K, V, []byte{0})
+				V = mac(K, V)
+			}
+			first = false
+			V = mac(K, V)
+			k := new(big.Int).SetBytes(V)
+			if k.Sign() > 0 && k.Cmp(N) < 0 {
+				return k
+			}
+		}
+	}
+}
+
+// hashToInt converts a digest to an integer as specified by SEC 1, truncating to the bit length of N.
+func hashToInt(digest []byte) *big.Int {
+	if len(digest) > 32 {
+		digest = digest[:32]
+	}
+	return new(big.Int).SetBytes(digest)
+}
+
+func mustHex(s string) *big.Int {
+	v, ok := new(big.Int).SetString(s, 16)
+	if !ok {
+		panic("bad hex constant " + s)
+	}
+	return v
+}
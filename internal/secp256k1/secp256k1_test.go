@@ -0,0 +1,46 @@
+package secp256k1
+
+import (
+	"crypto/sha256"
+	"math/big"
+	"testing"
+)
+
+func TestScalarBaseMult(t *testing.T) {
+	twoG := ScalarBaseMult(big.NewInt(2))
+	want := Point{
+		X: mustHex("c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5"),
+		Y: mustHex("1ae168fea63dc339a3c58419466ceaeef7f632653266d0e1236431a950cfe52a"),
+	}
+	if twoG.X.Cmp(want.X) != 0 || twoG.Y.Cmp(want.Y) != 0 {
+		t.Errorf("2G mismatch, got %x,%x", twoG.X, twoG.Y)
+	} else if !twoG.IsOnCurve() {
+		t.Error("2G not on curve")
+	}
+	if !ScalarBaseMult(N).IsInfinity() {
+		t.Error("expected N*G to be the point at infinity")
+	}
+}
+
+func TestSign(t *testing.T) {
+	// Deterministic nonce test vector for private key 1.
+	digest := sha256.Sum256([]byte("Satoshi Nakamoto"))
+	d := big.NewInt(1)
+	k := nonces(d, hashToInt(digest[:]))()
+	if want := mustHex("8f8a276c19f4149656b280621e358cce24f5f52542772691ee69063b74f15d15"); k.Cmp(want) != 0 {
+		t.Errorf("RFC 6979 nonce mismatch, got %x", k)
+	}
+	d = mustHex("c9afa9d845ba75166b5c215767b1d6934e50c3db36e89b127b8a622b120f6721")
+	pub := ScalarBaseMult(d)
+	r, s, err := Sign(d, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(pub, digest[:], r, s) {
+		t.Fatal("signature failed to verify")
+	}
+	digest[0] ^= 1
+	if Verify(pub, digest[:], r, s) {
+		t.Error("signature verified for wrong digest")
+	}
+}